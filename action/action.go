@@ -1,30 +1,64 @@
 package action
 
 import (
+	"context"
+	"path/filepath"
 	"github.com/troykinsella/crash/util"
 	"github.com/troykinsella/crash/logging"
 )
 
 type Action interface {
-	Run() (*Result, error)
+	// Runs the action, which stops early when the given context is done,
+	// such as when the step times out.
+	Run(ctx context.Context) (*Result, error)
 }
 
 type ActionConfig struct {
-	Name   string
-	Params util.Values
-	Log    *logging.Logger
+	Name     string
+	Params   util.Values
+	Log      *logging.Logger
+	Sessions *Sessions
+	Dir      string
+}
+
+// Returns the given file path, resolved against the directory of the Crashfile
+// when it is relative.
+func (c *ActionConfig) Path(p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(c.Dir, p)
 }
 
 type Result struct {
 	Data    map[string]interface{}
 }
 
-func NewAction(config *ActionConfig) Action {
-	switch config.Name {
-	case "http":
-		return NewHttp(config)
-	case "shell":
-		return NewShell(config)
-	}
-	return nil
+// The registry of action types available to Crashfiles.
+var Actions = NewRegistry()
+
+func init() {
+	Actions.Register("http", func(c *ActionConfig) Action { return NewHttp(c) }, httpParams...)
+	Actions.Register("shell", func(c *ActionConfig) Action { return NewShell(c) }, shellParams...)
+	Actions.Register("sse", func(c *ActionConfig) Action { return NewSse(c) }, sseParams...)
+	Actions.Register("websocket", func(c *ActionConfig) Action { return NewWebSocket(c) }, webSocketParams...)
+	Actions.Register("grpc", func(c *ActionConfig) Action { return NewGrpc(c) }, grpcParams...)
+	Actions.Register("tcp", func(c *ActionConfig) Action { return NewTcp(c) }, tcpParams...)
+	Actions.Register("udp", func(c *ActionConfig) Action { return NewUdp(c) }, udpParams...)
+	Actions.Register("sql", func(c *ActionConfig) Action { return NewSql(c) }, sqlParams...)
+}
+
+// Registers an action type with the default registry, making it available
+// to Crashfiles. See Registry.Register.
+func Register(name string, factory Factory, params ...Param) {
+	Actions.Register(name, factory, params...)
+}
+
+// Checks the action type and parameters against the default registry.
+func Validate(name string, params map[string]interface{}) error {
+	return Actions.Validate(name, params)
+}
+
+func NewAction(config *ActionConfig) (Action, error) {
+	return Actions.New(config)
 }
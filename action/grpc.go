@@ -0,0 +1,297 @@
+package action
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/troykinsella/crash/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Grpc calls a unary or server-streaming gRPC method. Message types are
+// resolved from a protoset file, or using server reflection.
+type Grpc struct {
+	config *ActionConfig
+}
+
+var grpcParams = append([]Param{
+	{Name: "address", Type: STRING, Required: true},
+	{Name: "method", Type: STRING, Required: true},
+	{Name: "request", Type: ANY},
+	{Name: "protoset", Type: STRING},
+	{Name: "metadata", Type: MAP},
+	{Name: "plaintext", Type: BOOL},
+}, tlsParams...)
+
+// Splits a "package.Service/Method" or "package.Service.Method" name.
+func parseGrpcMethod(name string) (protoreflect.FullName, protoreflect.Name, error) {
+	name = strings.TrimPrefix(name, "/")
+	i := strings.LastIndexAny(name, "/.")
+	if i <= 0 || i == len(name)-1 {
+		return "", "", fmt.Errorf("invalid method parameter; expected package.Service/Method: %s", name)
+	}
+	return protoreflect.FullName(name[:i]), protoreflect.Name(name[i+1:]), nil
+}
+
+func (g *Grpc) loadProtoset(path string) (*protoregistry.Files, error) {
+	b, err := ioutil.ReadFile(g.config.Path(path))
+	if err != nil {
+		return nil, err
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("invalid protoset file: %s: %s", path, err.Error())
+	}
+	return protodesc.NewFiles(&set)
+}
+
+func (g *Grpc) dialOptions() ([]grpc.DialOption, error) {
+	opts := make([]grpc.DialOption, 0)
+
+	plaintext := false
+	if pt := g.config.Params.GetString("plaintext"); pt != "" {
+		b, err := strconv.ParseBool(pt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plaintext parameter: %s", pt)
+		}
+		plaintext = b
+	}
+
+	if plaintext {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	} else {
+		tlsConfig, err := newTlsConfig(g.config)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	}
+
+	return opts, nil
+}
+
+// Returns the request message given by the request parameter, which is
+// either a map, or a JSON string.
+func (g *Grpc) request(md protoreflect.MessageDescriptor, resolver *protoregistry.Types) (proto.Message, error) {
+	msg := dynamicpb.NewMessage(md)
+
+	var b []byte
+	switch r := g.config.Params.Get("request").(type) {
+	case nil:
+		return msg, nil
+	case string:
+		if r == "" {
+			return msg, nil
+		}
+		b = []byte(r)
+	default:
+		j, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		b = j
+	}
+
+	opts := protojson.UnmarshalOptions{
+		Resolver: resolver,
+	}
+	if err := opts.Unmarshal(b, msg); err != nil {
+		return nil, fmt.Errorf("invalid request parameter: %s", err.Error())
+	}
+	return msg, nil
+}
+
+func (g *Grpc) Run(ctx context.Context) (*Result, error) {
+	p := g.config.Params
+
+	address := p.GetString("address")
+	if address == "" {
+		return nil, fmt.Errorf("address parameter required")
+	}
+
+	service, method, err := parseGrpcMethod(p.GetString("method"))
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := g.dialOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.NewClient(address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var files *protoregistry.Files
+	if protoset := p.GetString("protoset"); protoset != "" {
+		files, err = g.loadProtoset(protoset)
+	} else {
+		files, err = resolveByReflection(ctx, conn, string(service))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := files.FindDescriptorByName(service)
+	if err != nil {
+		return nil, fmt.Errorf("service not found: %s", service)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("not a service: %s", service)
+	}
+	md := sd.Methods().ByName(method)
+	if md == nil {
+		return nil, fmt.Errorf("method not found: %s/%s", service, method)
+	}
+	if md.IsStreamingClient() {
+		return nil, fmt.Errorf("client streaming methods are not supported: %s/%s", service, method)
+	}
+
+	types := dynamicTypes(files)
+
+	req, err := g.request(md.Input(), types)
+	if err != nil {
+		return nil, err
+	}
+
+	outgoing := metadata.MD{}
+	for k, v := range util.ToStringMap(p.Get("metadata")) {
+		outgoing.Append(k, formValues(v)...)
+	}
+	ctx = metadata.NewOutgoingContext(ctx, outgoing)
+
+	fullMethod := fmt.Sprintf("/%s/%s", service, method)
+	g.config.Log.Debugf("%s %s", address, fullMethod)
+
+	start := time.Now()
+	var header, trailer metadata.MD
+	responses := make([]interface{}, 0)
+
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{
+		ServerStreams: md.IsStreamingServer(),
+	}, fullMethod, grpc.Header(&header), grpc.Trailer(&trailer))
+	if err == nil {
+		err = stream.SendMsg(req)
+	}
+	if err == nil {
+		err = stream.CloseSend()
+	}
+	for err == nil {
+		resp := dynamicpb.NewMessage(md.Output())
+		err = stream.RecvMsg(resp)
+		if err == nil {
+			r, err2 := grpcMessageToMap(resp, types)
+			if err2 != nil {
+				return nil, err2
+			}
+			responses = append(responses, r)
+		}
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	duration := time.Since(start)
+
+	st := status.Convert(err)
+	g.config.Log.Infof("%s %s -> %s", address, fullMethod, st.Code().String())
+
+	data := map[string]interface{}{
+		"status-code":    int(st.Code()),
+		"status":         st.Code().String(),
+		"message":        st.Message(),
+		"responses":      responses,
+		"response-count": len(responses),
+		"headers":        metadataToMap(header),
+		"trailers":       metadataToMap(trailer),
+		"time":           int(duration / time.Millisecond),
+	}
+	if len(responses) > 0 {
+		data["response"] = responses[0]
+	}
+
+	return &Result{
+		Data: data,
+	}, nil
+}
+
+func dynamicTypes(files *protoregistry.Files) *protoregistry.Types {
+	types := new(protoregistry.Types)
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		registerMessageTypes(types, fd.Messages())
+		return true
+	})
+	return types
+}
+
+func registerMessageTypes(types *protoregistry.Types, mds protoreflect.MessageDescriptors) {
+	for i := 0; i < mds.Len(); i++ {
+		md := mds.Get(i)
+		types.RegisterMessage(dynamicpb.NewMessageType(md))
+		registerMessageTypes(types, md.Messages())
+	}
+}
+
+// Converts a message into nested maps and slices by way of JSON, using the
+// field names declared in the proto file.
+func grpcMessageToMap(msg proto.Message, types *protoregistry.Types) (interface{}, error) {
+	opts := protojson.MarshalOptions{
+		UseProtoNames:   true,
+		EmitUnpopulated: true,
+		Resolver:        types,
+	}
+	b, err := opts.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJson(b)
+}
+
+func metadataToMap(md metadata.MD) map[string]interface{} {
+	result := make(map[string]interface{}, len(md))
+	for k, v := range md {
+		result[k] = strings.Join(v, ", ")
+	}
+	return result
+}
+
+func grpcStatusIs(err error, code codes.Code) bool {
+	return status.Code(err) == code
+}
+
+func NewGrpc(config *ActionConfig) *Grpc {
+	return &Grpc{
+		config: config,
+	}
+}
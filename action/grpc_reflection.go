@@ -0,0 +1,135 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	rpbalpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Fetches the serialized file descriptors containing a symbol, or having a
+// file name, from a server reflection service.
+type reflectionFetcher func(symbol string, filename string) ([][]byte, error)
+
+func newReflectionFetcher(ctx context.Context, conn *grpc.ClientConn) (reflectionFetcher, func(), error) {
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fetch := func(symbol string, filename string) ([][]byte, error) {
+		req := &rpb.ServerReflectionRequest{}
+		if symbol != "" {
+			req.MessageRequest = &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol}
+		} else {
+			req.MessageRequest = &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: filename}
+		}
+		if err := stream.Send(req); err != nil {
+			return nil, err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, fmt.Errorf("server reflection: %s", e.GetErrorMessage())
+		}
+		return resp.GetFileDescriptorResponse().GetFileDescriptorProto(), nil
+	}
+
+	return fetch, func() { stream.CloseSend() }, nil
+}
+
+// The same as newReflectionFetcher, for servers supporting only the v1alpha
+// reflection service.
+func newAlphaReflectionFetcher(ctx context.Context, conn *grpc.ClientConn) (reflectionFetcher, func(), error) {
+	stream, err := rpbalpha.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fetch := func(symbol string, filename string) ([][]byte, error) {
+		req := &rpbalpha.ServerReflectionRequest{}
+		if symbol != "" {
+			req.MessageRequest = &rpbalpha.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol}
+		} else {
+			req.MessageRequest = &rpbalpha.ServerReflectionRequest_FileByFilename{FileByFilename: filename}
+		}
+		if err := stream.Send(req); err != nil {
+			return nil, err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, fmt.Errorf("server reflection: %s", e.GetErrorMessage())
+		}
+		return resp.GetFileDescriptorResponse().GetFileDescriptorProto(), nil
+	}
+
+	return fetch, func() { stream.CloseSend() }, nil
+}
+
+// Resolves the file defining a service, and all of its dependencies, using
+// server reflection.
+func resolveByReflection(ctx context.Context, conn *grpc.ClientConn, service string) (*protoregistry.Files, error) {
+	fetch, closeFetch, err := newReflectionFetcher(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := fetch(service, "")
+	if grpcStatusIs(err, codes.Unimplemented) {
+		closeFetch()
+		fetch, closeFetch, err = newAlphaReflectionFetcher(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+		b, err = fetch(service, "")
+	}
+	defer closeFetch()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*descriptorpb.FileDescriptorProto)
+	pending := b
+
+	for len(pending) > 0 {
+		for _, fb := range pending {
+			fd := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(fb, fd); err != nil {
+				return nil, err
+			}
+			files[fd.GetName()] = fd
+		}
+		pending = nil
+
+		// Fetch dependencies the server didn't already send
+		for _, fd := range files {
+			for _, dep := range fd.GetDependency() {
+				if files[dep] != nil {
+					continue
+				}
+				b, err := fetch("", dep)
+				if err != nil {
+					return nil, err
+				}
+				pending = append(pending, b...)
+			}
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range files {
+		set.File = append(set.File, fd)
+	}
+	return protodesc.NewFiles(set)
+}
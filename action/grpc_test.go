@@ -0,0 +1,251 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"github.com/troykinsella/crash/logging"
+	"github.com/troykinsella/crash/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Describes:
+//
+//   package test;
+//   message HelloRequest { string name = 1; int32 count = 2; }
+//   message HelloReply { string greeting = 1; int32 n = 2; }
+//   service Greeter {
+//     rpc Hello(HelloRequest) returns (HelloReply);
+//     rpc HelloStream(HelloRequest) returns (stream HelloReply);
+//   }
+func testGreeterFile() *descriptorpb.FileDescriptorProto {
+	field := func(name string, number int32, t descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     t.Enum(),
+		}
+	}
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("test/greeter.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("HelloRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+					field("count", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+				},
+			},
+			{
+				Name: proto.String("HelloReply"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("greeting", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+					field("n", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+				},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("Greeter"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					{
+						Name:       proto.String("Hello"),
+						InputType:  proto.String(".test.HelloRequest"),
+						OutputType: proto.String(".test.HelloReply"),
+					},
+					{
+						Name:            proto.String("HelloStream"),
+						InputType:       proto.String(".test.HelloRequest"),
+						OutputType:      proto.String(".test.HelloReply"),
+						ServerStreaming: proto.Bool(true),
+					},
+				},
+			},
+		},
+	}
+}
+
+func startTestGreeter(t *testing.T, files *protoregistry.Files) (string, func()) {
+	d, _ := files.FindDescriptorByName("test.Greeter")
+	sd := d.(protoreflect.ServiceDescriptor)
+	reqType := sd.Methods().ByName("Hello").Input()
+	replyType := sd.Methods().ByName("Hello").Output()
+
+	reply := func(name string, n int) *dynamicpb.Message {
+		r := dynamicpb.NewMessage(replyType)
+		r.Set(replyType.Fields().ByName("greeting"), protoreflect.ValueOfString("hello "+name))
+		r.Set(replyType.Fields().ByName("n"), protoreflect.ValueOfInt32(int32(n)))
+		return r
+	}
+
+	desc := &grpc.ServiceDesc{
+		ServiceName: "test.Greeter",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{
+			{
+				MethodName: "Hello",
+				Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+					req := dynamicpb.NewMessage(reqType)
+					if err := dec(req); err != nil {
+						return nil, err
+					}
+					name := req.Get(reqType.Fields().ByName("name")).String()
+					if name == "" {
+						return nil, status.Error(codes.InvalidArgument, "name required")
+					}
+					md, _ := metadata.FromIncomingContext(ctx)
+					grpc.SetHeader(ctx, metadata.Pairs("x-user", fmt.Sprint(md.Get("x-user"))))
+					return reply(name, 1), nil
+				},
+			},
+		},
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName:    "HelloStream",
+				ServerStreams: true,
+				Handler: func(srv interface{}, stream grpc.ServerStream) error {
+					req := dynamicpb.NewMessage(reqType)
+					if err := stream.RecvMsg(req); err != nil {
+						return err
+					}
+					name := req.Get(reqType.Fields().ByName("name")).String()
+					count := int(req.Get(reqType.Fields().ByName("count")).Int())
+					for i := 0; i < count; i++ {
+						if err := stream.SendMsg(reply(name, i)); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			},
+		},
+	}
+
+	server := grpc.NewServer()
+	server.RegisterService(desc, struct{}{})
+	rpb.RegisterServerReflectionServer(server, reflection.NewServerV1(reflection.ServerOptions{
+		Services:           server,
+		DescriptorResolver: files,
+	}))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+
+	return l.Addr().String(), server.Stop
+}
+
+func TestGrpc(t *testing.T) {
+	fdp := testGreeterFile()
+	files, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{fdp},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address, stop := startTestGreeter(t, files)
+	defer stop()
+
+	protoset, err := ioutil.TempFile("", "crash-protoset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(protoset.Name())
+	b, _ := proto.Marshal(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{fdp},
+	})
+	protoset.Write(b)
+	protoset.Close()
+
+	var tests = []struct {
+		params    map[string]interface{}
+		status    string
+		greetings []string
+	}{
+		{
+			map[string]interface{}{
+				"method":  "test.Greeter/Hello",
+				"request": map[string]interface{}{"name": "alice"},
+			},
+			"OK", []string{"hello alice"},
+		},
+		{
+			map[string]interface{}{
+				"method":   "test.Greeter.Hello",
+				"request":  `{"name": "bob"}`,
+				"protoset": protoset.Name(),
+			},
+			"OK", []string{"hello bob"},
+		},
+		{
+			map[string]interface{}{
+				"method": "test.Greeter/Hello",
+			},
+			"InvalidArgument", []string{},
+		},
+		{
+			map[string]interface{}{
+				"method":  "test.Greeter/HelloStream",
+				"request": map[string]interface{}{"name": "carol", "count": 3},
+			},
+			"OK", []string{"hello carol", "hello carol", "hello carol"},
+		},
+	}
+
+	for i, test := range tests {
+		test.params["address"] = address
+		test.params["plaintext"] = true
+		test.params["metadata"] = map[interface{}]interface{}{"x-user": "alice"}
+
+		a := NewGrpc(&ActionConfig{
+			Name:   "grpc",
+			Params: util.AsValues(test.params),
+			Log:    logging.NewLogger(logging.L_OFF, false, false),
+		})
+
+		r, err := a.Run(context.Background())
+		if err != nil {
+			t.Errorf("%d. unexpected error: %s\n", i, err.Error())
+			continue
+		}
+
+		if r.Data["status"] != test.status {
+			t.Errorf("%d. unexpected status:\nexpected=%s,\nactual=%v (%v)\n", i, test.status, r.Data["status"], r.Data["message"])
+		}
+		responses := r.Data["responses"].([]interface{})
+		if len(responses) != len(test.greetings) {
+			t.Errorf("%d. unexpected responses: %v\n", i, responses)
+			continue
+		}
+		for j, g := range test.greetings {
+			resp := responses[j].(map[string]interface{})
+			if resp["greeting"] != g {
+				t.Errorf("%d. unexpected greeting %d:\nexpected=%s,\nactual=%v\n", i, j, g, resp["greeting"])
+			}
+		}
+		if len(responses) == 1 && r.Data["headers"].(map[string]interface{})["x-user"] != "[alice]" {
+			t.Errorf("%d. unexpected headers: %v\n", i, r.Data["headers"])
+		}
+	}
+}
@@ -1,20 +1,62 @@
 package action
 
 import (
+	"context"
 	"io/ioutil"
 	"net/http"
 	"strings"
 	"fmt"
+	"io"
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"mime"
+	"strconv"
+	"github.com/troykinsella/crash/util"
 )
 
+const defaultMaxRedirects = 10
+
+var httpParams = append([]Param{
+	{Name: "url", Type: STRING, Required: true},
+	{Name: "method", Type: STRING, Default: "GET"},
+	{Name: "headers", Type: MAP},
+	{Name: "query", Type: MAP},
+	{Name: "body", Type: ANY},
+	{Name: "body_file", Type: STRING},
+	{Name: "form", Type: MAP},
+	{Name: "files", Type: MAP},
+	{Name: "follow_redirects", Type: STRING},
+	{Name: "session", Type: STRING},
+}, tlsParams...)
+
 type Http struct {
-	config *ActionConfig
+	config         *ActionConfig
+	defaultHeaders http.Header
 }
 
-func (h *Http) Run() (*Result, error) {
+func (h *Http) Run(ctx context.Context) (*Result, error) {
+	resp, timer, redirects, err := h.do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result, err := h.genResult(resp, timer)
+	if err != nil {
+		return nil, err
+	}
+	result.Data["redirects"] = redirects
+
+	return result, nil
+}
+
+// Sends the request described by the action parameters, returning the response
+// having an unread body, along with the request timer and the redirects followed.
+func (h *Http) do(ctx context.Context) (*http.Response, *httpTimer, []interface{}, error) {
 	url := h.config.Params.GetString("url")
 	if url == "" {
-		return nil, fmt.Errorf("url parameter required")
+		return nil, nil, nil, fmt.Errorf("url parameter required")
 	}
 
 	method := h.config.Params.GetString("method")
@@ -24,32 +66,231 @@ func (h *Http) Run() (*Result, error) {
 		method = strings.ToUpper(method)
 	}
 
-	client := &http.Client{}
+	url, err := h.buildUrl(url)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	body, contentType, err := h.buildBody()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	client, err := h.newClient()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	maxRedirects, err := h.maxRedirects()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	redirects := make([]interface{}, 0)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if maxRedirects == 0 {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > maxRedirects {
+			// The last redirect response is the result, for checks to assert on
+			return http.ErrUseLastResponse
+		}
+
+		prev := req.Response
+		redirects = append(redirects, map[string]interface{}{
+			"status-code": prev.StatusCode,
+			"location": prev.Header.Get("Location"),
+			"url": req.URL.String(),
+		})
+		return nil
+	}
 
 	h.config.Log.Debugf("%s %s", method, url)
 
-	req, err := http.NewRequest(method, url, nil)
+	req, err := http.NewRequest(method, url, body)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
+	}
+	req = req.WithContext(ctx)
+
+	for name, values := range h.defaultHeaders {
+		req.Header[name] = values
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
 	}
+	h.setHeaders(req)
+
+	timer := newHttpTimer()
+	req = timer.trace(req)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
-	result, err := h.genResult(resp)
+	return resp, timer, redirects, nil
+}
+
+func (h *Http) newClient() (*http.Client, error) {
+	tlsConfig, err := newTlsConfig(h.config)
 	if err != nil {
 		return nil, err
 	}
 
-	return result, nil
+	newTransport := func() *http.Transport {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		return transport
+	}
+
+	client := &http.Client{}
+
+	session := h.config.Params.GetString("session")
+	if session != "" {
+		if h.config.Sessions == nil {
+			return nil, fmt.Errorf("sessions are not available")
+		}
+		hs := h.config.Sessions.Http(session, newTransport)
+		client.Jar = hs.Jar
+		client.Transport = hs.Transport
+	} else if tlsConfig != nil {
+		// No session to reuse connections with
+		transport := newTransport()
+		transport.DisableKeepAlives = true
+		client.Transport = transport
+	}
+
+	return client, nil
 }
 
-func (h *Http) genResult(resp *http.Response) (*Result, error) {
+// Returns the maximum number of redirects to follow, where zero
+// means redirects are not followed.
+func (h *Http) maxRedirects() (int, error) {
+	follow := h.config.Params.GetString("follow_redirects")
+	switch follow {
+	case "", "true":
+		return defaultMaxRedirects, nil
+	case "false":
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(follow)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid follow_redirects parameter: %s", follow)
+	}
+	return n, nil
+}
+
+func (h *Http) buildUrl(rawUrl string) (string, error) {
+	query := util.ToStringMap(h.config.Params.Get("query"))
+	if len(query) == 0 {
+		return rawUrl, nil
+	}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	for name, val := range query {
+		switch v := val.(type) {
+		case []interface{}:
+			for _, item := range v {
+				q.Add(name, util.ToString(item))
+			}
+		default:
+			q.Add(name, util.ToString(v))
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// Returns the request body, and the content type implied by it, if any.
+func (h *Http) buildBody() (io.Reader, string, error) {
+	body := h.config.Params.Get("body")
+	bodyFile := h.config.Params.GetString("body_file")
+	form := util.ToStringMap(h.config.Params.Get("form"))
+	files := util.ToStringMap(h.config.Params.Get("files"))
+
+	bodies := 0
+	for _, given := range []bool{body != nil && body != "", bodyFile != "", len(form) > 0 || len(files) > 0} {
+		if given {
+			bodies++
+		}
+	}
+	if bodies > 1 {
+		return nil, "", fmt.Errorf("body, body_file, and form or files parameters are mutually exclusive")
+	}
+
+	if len(files) > 0 {
+		return h.buildMultipartBody(form, files)
+	}
+	if len(form) > 0 {
+		return h.buildFormBody(form)
+	}
+
+	if bodyFile != "" {
+		b, err := ioutil.ReadFile(h.config.Path(bodyFile))
+		if err != nil {
+			return nil, "", err
+		}
+		return bytes.NewReader(b), "", nil
+	}
+
+	switch b := body.(type) {
+	case nil:
+		return nil, "", nil
+	case string:
+		if b == "" {
+			return nil, "", nil
+		}
+		return strings.NewReader(b), "", nil
+	case map[string]interface{}, []interface{}:
+		j, err := json.Marshal(b)
+		if err != nil {
+			return nil, "", err
+		}
+		return bytes.NewReader(j), "application/json", nil
+	}
+
+	return strings.NewReader(util.ToString(body)), "", nil
+}
+
+// Sets the headers given by the headers param into the given header map.
+func setHeaders(params util.Values, header http.Header) {
+	headers := util.ToStringMap(params.Get("headers"))
+	for name, val := range headers {
+		switch v := val.(type) {
+		case []interface{}:
+			header.Del(name)
+			for _, item := range v {
+				header.Add(name, util.ToString(item))
+			}
+		default:
+			header.Set(name, util.ToString(v))
+		}
+	}
+}
+
+func (h *Http) setHeaders(req *http.Request) {
+	setHeaders(h.config.Params, req.Header)
+
+	// Go doesn't send the Host header from the header map
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+}
+
+func (h *Http) genResult(resp *http.Response, timer *httpTimer) (*Result, error) {
 	data := make(map[string]interface{})
 	data["status-code"] = resp.StatusCode
 	data["headers"] = resp.Header
+	if resp.TLS != nil {
+		data["tls"] = genTlsResult(resp.TLS)
+	}
 
 	h.config.Log.Infof("%s %s -> %d", resp.Request.Method, resp.Request.URL.String(), resp.StatusCode)
 
@@ -57,15 +298,68 @@ func (h *Http) genResult(resp *http.Response) (*Result, error) {
 	if err != nil {
 		return nil, err
 	}
+	timer.finish()
+	data["timing"] = timer.result()
 
 	data["raw-body"] = bodyBytes
 	data["body"] = string(bodyBytes)
 
+	if isJsonContentType(resp.Header.Get("Content-Type")) && len(bodyBytes) > 0 {
+		j, err := decodeJson(bodyBytes)
+		if err != nil {
+			h.config.Log.Debugf("cannot decode JSON response body: %s", err.Error())
+		} else {
+			data["json"] = j
+		}
+	}
+
 	return &Result{
 		Data:    data,
 	}, nil
 }
 
+func isJsonContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" ||
+		(strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"))
+}
+
+// Decodes JSON into nested maps and slices, converting numbers into ints
+// where possible so that they compare naturally in checks.
+func decodeJson(b []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	return normalizeJson(v), nil
+}
+
+func normalizeJson(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return int(i)
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		for k, mv := range t {
+			t[k] = normalizeJson(mv)
+		}
+	case []interface{}:
+		for i, lv := range t {
+			t[i] = normalizeJson(lv)
+		}
+	}
+	return v
+}
+
 func NewHttp(config *ActionConfig) *Http {
 	return &Http{
 		config: config,
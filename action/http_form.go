@@ -0,0 +1,76 @@
+package action
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"github.com/troykinsella/crash/util"
+)
+
+// Returns the values of a form or files parameter entry, where an entry
+// may be a single value or a list of values.
+func formValues(val interface{}) []string {
+	if list, ok := val.([]interface{}); ok {
+		result := make([]string, len(list))
+		for i, item := range list {
+			result[i] = util.ToString(item)
+		}
+		return result
+	}
+	return []string{util.ToString(val)}
+}
+
+func (h *Http) buildFormBody(form map[string]interface{}) (io.Reader, string, error) {
+	values := url.Values{}
+	for name, val := range form {
+		for _, v := range formValues(val) {
+			values.Add(name, v)
+		}
+	}
+	return strings.NewReader(values.Encode()), "application/x-www-form-urlencoded", nil
+}
+
+func (h *Http) buildMultipartBody(form map[string]interface{}, files map[string]interface{}) (io.Reader, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	for _, name := range util.SortedKeysForMapStringInterface(form) {
+		for _, v := range formValues(form[name]) {
+			if err := w.WriteField(name, v); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	for _, name := range util.SortedKeysForMapStringInterface(files) {
+		for _, path := range formValues(files[name]) {
+			if err := h.writeFormFile(w, name, path); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return &buf, w.FormDataContentType(), nil
+}
+
+func (h *Http) writeFormFile(w *multipart.Writer, name string, path string) error {
+	f, err := os.Open(h.config.Path(path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	part, err := w.CreateFormFile(name, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, f)
+	return err
+}
@@ -0,0 +1,432 @@
+package action
+
+import (
+	"context"
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"io/ioutil"
+	"os"
+	"encoding/pem"
+	"time"
+	"strings"
+	"fmt"
+	"path/filepath"
+	"github.com/troykinsella/crash/util"
+	"github.com/troykinsella/crash/logging"
+)
+
+func newTestHttp(params map[string]interface{}) *Http {
+	return NewHttp(&ActionConfig{
+		Name: "http",
+		Params: util.AsValues(params),
+		Log: logging.NewLogger(logging.L_OFF, false, false),
+	})
+}
+
+func TestHttpRequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Query", r.URL.RawQuery)
+		w.Header().Set("X-Content-Type", r.Header.Get("Content-Type"))
+		w.Header().Set("X-Auth", r.Header.Get("Authorization"))
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	var tests = []struct {
+		params      map[string]interface{}
+		method      string
+		query       string
+		contentType string
+		auth        string
+		body        string
+	}{
+		{
+			map[string]interface{}{},
+			"GET", "", "", "", "",
+		},
+		{
+			map[string]interface{}{
+				"method": "post",
+				"body": "hello",
+				"headers": map[interface{}]interface{}{
+					"Content-Type": "text/plain",
+					"Authorization": "Bearer foo",
+				},
+			},
+			"POST", "", "text/plain", "Bearer foo", "hello",
+		},
+		{
+			map[string]interface{}{
+				"method": "put",
+				"body": map[string]interface{}{
+					"id": 42,
+				},
+			},
+			"PUT", "", "application/json", "", `{"id":42}`,
+		},
+		{
+			map[string]interface{}{
+				"query": map[interface{}]interface{}{
+					"a": "b",
+					"c": []interface{}{"d", "e"},
+				},
+			},
+			"GET", "a=b&c=d&c=e", "", "", "",
+		},
+	}
+
+	for i, test := range tests {
+		test.params["url"] = ts.URL
+		r, err := newTestHttp(test.params).Run(context.Background())
+		if err != nil {
+			t.Errorf("%d. unexpected error: %s\n", i, err.Error())
+			continue
+		}
+
+		headers := r.Data["headers"].(http.Header)
+		if headers.Get("X-Method") != test.method {
+			t.Errorf("%d. unexpected method:\nexpected=%s,\nactual=%s\n", i, test.method, headers.Get("X-Method"))
+		}
+		if headers.Get("X-Query") != test.query {
+			t.Errorf("%d. unexpected query:\nexpected=%s,\nactual=%s\n", i, test.query, headers.Get("X-Query"))
+		}
+		if headers.Get("X-Content-Type") != test.contentType {
+			t.Errorf("%d. unexpected content type:\nexpected=%s,\nactual=%s\n", i, test.contentType, headers.Get("X-Content-Type"))
+		}
+		if headers.Get("X-Auth") != test.auth {
+			t.Errorf("%d. unexpected authorization:\nexpected=%s,\nactual=%s\n", i, test.auth, headers.Get("X-Auth"))
+		}
+		if r.Data["body"] != test.body {
+			t.Errorf("%d. unexpected body:\nexpected=%s,\nactual=%s\n", i, test.body, r.Data["body"])
+		}
+	}
+}
+
+func TestHttpJsonResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/json" {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "text/plain")
+		}
+		w.Write([]byte(`{"data": [{"id": 42, "score": 1.5, "name": "foo"}]}`))
+	}))
+	defer ts.Close()
+
+	r, err := newTestHttp(map[string]interface{}{
+		"url": ts.URL + "/json",
+	}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err.Error())
+	}
+
+	j, ok := r.Data["json"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected json output, found: %v\n", r.Data["json"])
+	}
+	item := j["data"].([]interface{})[0].(map[string]interface{})
+	if item["id"] != 42 {
+		t.Errorf("unexpected id: %v\n", item["id"])
+	}
+	if item["score"] != 1.5 {
+		t.Errorf("unexpected score: %v\n", item["score"])
+	}
+	if item["name"] != "foo" {
+		t.Errorf("unexpected name: %v\n", item["name"])
+	}
+
+	r, err = newTestHttp(map[string]interface{}{
+		"url": ts.URL + "/text",
+	}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err.Error())
+	}
+	if _, ok := r.Data["json"]; ok {
+		t.Errorf("unexpected json output for text/plain response\n")
+	}
+}
+
+func TestHttpTls(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	_, err := newTestHttp(map[string]interface{}{
+		"url": ts.URL,
+	}).Run(context.Background())
+	if err == nil {
+		t.Errorf("expected certificate verification error\n")
+	}
+
+	caFile, err := ioutil.TempFile("", "crash-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(caFile.Name())
+	pem.Encode(caFile, &pem.Block{
+		Type: "CERTIFICATE",
+		Bytes: ts.Certificate().Raw,
+	})
+	caFile.Close()
+
+	r, err := newTestHttp(map[string]interface{}{
+		"url": ts.URL,
+		"ca_file": caFile.Name(),
+		"tls_min_version": "1.2",
+	}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err.Error())
+	}
+
+	state := r.Data["tls"].(map[string]interface{})
+	if state["cipher-suite"] == "" {
+		t.Errorf("expected cipher suite\n")
+	}
+	certs := state["peer-certificates"].([]interface{})
+	if len(certs) != 1 {
+		t.Fatalf("unexpected peer certificate count: %d\n", len(certs))
+	}
+	cert := certs[0].(map[string]interface{})
+	if cert["expires-in-days"].(int) <= 0 {
+		t.Errorf("unexpected expires-in-days: %v\n", cert["expires-in-days"])
+	}
+
+	_, err = newTestHttp(map[string]interface{}{
+		"url": ts.URL,
+		"insecure_skip_verify": "true",
+	}).Run(context.Background())
+	if err != nil {
+		t.Errorf("unexpected error: %s\n", err.Error())
+	}
+}
+
+func TestHttpSession(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "user", Value: "alice"})
+			return
+		}
+		if c, err := r.Cookie("user"); err == nil {
+			w.Write([]byte(c.Value))
+		}
+	}))
+	defer ts.Close()
+
+	var tests = []struct {
+		session string
+		sessions *Sessions
+		body string
+	}{
+		{ "", NewSessions(nil), "" },
+		{ "alice", NewSessions(nil), "alice" },
+	}
+
+	for i, test := range tests {
+		for _, path := range []string{"/login", "/whoami"} {
+			a := newTestHttp(map[string]interface{}{
+				"url": ts.URL + path,
+				"session": test.session,
+			})
+			a.config.Sessions = test.sessions
+
+			r, err := a.Run(context.Background())
+			if err != nil {
+				t.Fatalf("%d. unexpected error: %s\n", i, err.Error())
+			}
+			if path == "/whoami" && r.Data["body"] != test.body {
+				t.Errorf("%d. unexpected body:\nexpected=%s,\nactual=%s\n", i, test.body, r.Data["body"])
+			}
+		}
+		test.sessions.Close()
+	}
+}
+
+func TestHttpTiming(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	r, err := newTestHttp(map[string]interface{}{
+		"url": ts.URL,
+	}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err.Error())
+	}
+
+	timing := r.Data["timing"].(map[string]interface{})
+	for _, phase := range []string{"dns", "connect", "tls", "ttfb", "transfer", "total"} {
+		if _, ok := timing[phase].(int); !ok {
+			t.Errorf("missing timing phase: %s\n", phase)
+		}
+	}
+	if timing["ttfb"].(int) < 20 {
+		t.Errorf("unexpected ttfb: %d\n", timing["ttfb"])
+	}
+	if timing["total"].(int) < timing["ttfb"].(int) {
+		t.Errorf("total %d less than ttfb %d\n", timing["total"], timing["ttfb"])
+	}
+}
+
+func TestHttpCancel(t *testing.T) {
+	release := make(chan bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancel()
+
+	_, err := newTestHttp(map[string]interface{}{
+		"url": ts.URL,
+	}).Run(ctx)
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("unexpected error: %v\n", err)
+	}
+}
+
+func TestHttpRedirects(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/older", http.StatusMovedPermanently)
+		case "/older":
+			http.Redirect(w, r, "/new", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	var tests = []struct {
+		follow     interface{}
+		statusCode int
+		hops       []int
+		err        string
+	}{
+		{ nil,     200, []int{301, 302}, "" },
+		{ true,    200, []int{301, 302}, "" },
+		{ false,   301, []int{}, "" },
+		{ 0,       301, []int{}, "" },
+		{ 2,       200, []int{301, 302}, "" },
+		{ 1,       302, []int{301}, "" },
+		{ "1",     302, []int{301}, "" },
+		{ "foo",   0,   nil, "invalid follow_redirects parameter: foo" },
+	}
+
+	for i, test := range tests {
+		r, err := newTestHttp(map[string]interface{}{
+			"url": ts.URL + "/old",
+			"follow_redirects": test.follow,
+		}).Run(context.Background())
+		if test.err != "" {
+			if err == nil || !strings.HasSuffix(err.Error(), test.err) {
+				t.Errorf("%d. expected error:\nexpected=%s,\nactual=%v\n", i, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d. unexpected error: %s\n", i, err.Error())
+			continue
+		}
+
+		if r.Data["status-code"] != test.statusCode {
+			t.Errorf("%d. unexpected status code:\nexpected=%d,\nactual=%v\n", i, test.statusCode, r.Data["status-code"])
+		}
+		redirects := r.Data["redirects"].([]interface{})
+		if len(redirects) != len(test.hops) {
+			t.Errorf("%d. unexpected redirect count:\nexpected=%d,\nactual=%d\n", i, len(test.hops), len(redirects))
+			continue
+		}
+		for j, hop := range test.hops {
+			if redirects[j].(map[string]interface{})["status-code"] != hop {
+				t.Errorf("%d. unexpected hop %d: %v\n", i, j, redirects[j])
+			}
+		}
+	}
+
+	r, _ := newTestHttp(map[string]interface{}{
+		"url": ts.URL + "/old",
+	}).Run(context.Background())
+	hop := r.Data["redirects"].([]interface{})[0].(map[string]interface{})
+	if hop["location"] != "/older" {
+		t.Errorf("unexpected location: %v\n", hop["location"])
+	}
+}
+
+func TestHttpForm(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1024); err != nil && err != http.ErrNotMultipart {
+			t.Errorf("cannot parse form: %s\n", err.Error())
+		}
+		result := r.PostForm.Encode()
+		if r.MultipartForm != nil {
+			for name, files := range r.MultipartForm.File {
+				f, _ := files[0].Open()
+				b, _ := ioutil.ReadAll(f)
+				result += fmt.Sprintf(";%s=%s:%s", name, files[0].Filename, b)
+			}
+		}
+		w.Write([]byte(result))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "crash-form")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "upload.txt"), []byte("hello"), 0644)
+
+	var tests = []struct {
+		params map[string]interface{}
+		body   string
+		err    string
+	}{
+		{
+			map[string]interface{}{
+				"form": map[interface{}]interface{}{ "a": "b", "c": []interface{}{"d", "e"} },
+			},
+			"a=b&c=d&c=e", "",
+		},
+		{
+			map[string]interface{}{
+				"form": map[interface{}]interface{}{ "a": "b" },
+				"files": map[interface{}]interface{}{ "f": "upload.txt" },
+			},
+			"a=b;f=upload.txt:hello", "",
+		},
+		{
+			map[string]interface{}{
+				"form": map[interface{}]interface{}{ "a": "b" },
+				"body": "foo",
+			},
+			"", "body, body_file, and form or files parameters are mutually exclusive",
+		},
+	}
+
+	for i, test := range tests {
+		test.params["url"] = ts.URL
+		test.params["method"] = "POST"
+		a := newTestHttp(test.params)
+		a.config.Dir = dir
+
+		r, err := a.Run(context.Background())
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%d. expected error:\nexpected=%s,\nactual=%v\n", i, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d. unexpected error: %s\n", i, err.Error())
+			continue
+		}
+		if r.Data["body"] != test.body {
+			t.Errorf("%d. unexpected body:\nexpected=%s,\nactual=%s\n", i, test.body, r.Data["body"])
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package action
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// httpTimer records the phases of an http request using httptrace.
+type httpTimer struct {
+	mutex sync.Mutex
+
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	firstByte    time.Time
+	done         time.Time
+}
+
+func newHttpTimer() *httpTimer {
+	return &httpTimer{}
+}
+
+func (t *httpTimer) set(field *time.Time, first bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if first && !field.IsZero() {
+		return
+	}
+	*field = time.Now()
+}
+
+// Returns the given request, traced by this timer, and starts the timer.
+func (t *httpTimer) trace(req *http.Request) *http.Request {
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.set(&t.dnsStart, true)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.set(&t.dnsDone, false)
+		},
+		ConnectStart: func(string, string) {
+			t.set(&t.connectStart, true)
+		},
+		ConnectDone: func(string, string, error) {
+			t.set(&t.connectDone, false)
+		},
+		TLSHandshakeStart: func() {
+			t.set(&t.tlsStart, true)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.set(&t.tlsDone, false)
+		},
+		GotFirstResponseByte: func() {
+			t.set(&t.firstByte, true)
+		},
+	}
+
+	t.start = time.Now()
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+// Stops the timer once the response body has been read.
+func (t *httpTimer) finish() {
+	t.set(&t.done, false)
+}
+
+func millis(from time.Time, to time.Time) int {
+	if from.IsZero() || to.IsZero() {
+		return 0
+	}
+	return int(to.Sub(from) / time.Millisecond)
+}
+
+// Returns the phase durations, in milliseconds. Phases that didn't happen,
+// such as connecting over a reused connection, have a zero duration.
+func (t *httpTimer) result() map[string]interface{} {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return map[string]interface{}{
+		"dns":      millis(t.dnsStart, t.dnsDone),
+		"connect":  millis(t.connectStart, t.connectDone),
+		"tls":      millis(t.tlsStart, t.tlsDone),
+		"ttfb":     millis(t.start, t.firstByte),
+		"transfer": millis(t.firstByte, t.done),
+		"total":    millis(t.start, t.done),
+	}
+}
@@ -0,0 +1,142 @@
+package action
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+)
+
+var tlsParams = []Param{
+	{Name: "ca_file", Type: STRING},
+	{Name: "cert_file", Type: STRING},
+	{Name: "key_file", Type: STRING},
+	{Name: "insecure_skip_verify", Type: BOOL},
+	{Name: "server_name", Type: STRING},
+	{Name: "tls_min_version", Type: STRING},
+	{Name: "tls_max_version", Type: STRING},
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func parseTlsVersion(s string) (uint16, error) {
+	if s == "" {
+		return 0, nil
+	}
+	v, ok := tlsVersions[s]
+	if !ok {
+		return 0, fmt.Errorf("invalid TLS version: %s", s)
+	}
+	return v, nil
+}
+
+func tlsVersionName(v uint16) string {
+	for name, version := range tlsVersions {
+		if version == v {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%04x", v)
+}
+
+// Returns a TLS configuration built from the action parameters, or nil when
+// no TLS parameters are given.
+func newTlsConfig(c *ActionConfig) (*tls.Config, error) {
+	p := c.Params
+
+	caFile := p.GetString("ca_file")
+	certFile := p.GetString("cert_file")
+	keyFile := p.GetString("key_file")
+	insecure := p.GetString("insecure_skip_verify")
+	serverName := p.GetString("server_name")
+	minVersion := p.GetString("tls_min_version")
+	maxVersion := p.GetString("tls_max_version")
+
+	if caFile == "" && certFile == "" && keyFile == "" && insecure == "" &&
+		serverName == "" && minVersion == "" && maxVersion == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		ServerName: serverName,
+	}
+
+	if insecure != "" {
+		b, err := strconv.ParseBool(insecure)
+		if err != nil {
+			return nil, fmt.Errorf("invalid insecure_skip_verify parameter: %s", insecure)
+		}
+		config.InsecureSkipVerify = b
+	}
+
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(c.Path(caFile))
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca_file: %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("cert_file and key_file parameters must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(c.Path(certFile), c.Path(keyFile))
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	var err error
+	config.MinVersion, err = parseTlsVersion(minVersion)
+	if err != nil {
+		return nil, err
+	}
+	config.MaxVersion, err = parseTlsVersion(maxVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func genTlsResult(state *tls.ConnectionState) map[string]interface{} {
+	certs := make([]interface{}, len(state.PeerCertificates))
+	for i, cert := range state.PeerCertificates {
+		sans := make([]interface{}, 0, len(cert.DNSNames)+len(cert.IPAddresses))
+		for _, name := range cert.DNSNames {
+			sans = append(sans, name)
+		}
+		for _, ip := range cert.IPAddresses {
+			sans = append(sans, ip.String())
+		}
+
+		certs[i] = map[string]interface{}{
+			"subject":         cert.Subject.String(),
+			"issuer":          cert.Issuer.String(),
+			"sans":            sans,
+			"not-before":      cert.NotBefore.UTC().Format(time.RFC3339),
+			"not-after":       cert.NotAfter.UTC().Format(time.RFC3339),
+			"expires-in-days": int(time.Until(cert.NotAfter).Hours() / 24),
+		}
+	}
+
+	return map[string]interface{}{
+		"version":           tlsVersionName(state.Version),
+		"protocol":          state.NegotiatedProtocol,
+		"cipher-suite":      tls.CipherSuiteName(state.CipherSuite),
+		"peer-certificates": certs,
+	}
+}
@@ -0,0 +1,141 @@
+package action
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"github.com/troykinsella/crash/util"
+)
+
+// The prefix of the names of action plugin executables.
+const PluginPrefix = "crash-action-"
+
+// Plugin runs an action implemented by an external executable. The request
+// is written to the executable's stdin as JSON, having the "type" of the
+// action, its interpolated "params", and the "dir" of the Crashfile. The
+// executable then writes a JSON response to stdout, having any of:
+//
+//   * "data": the map of outputs.
+//   * "error": a message indicating that the action failed.
+//   * "log": a list of messages to log.
+type Plugin struct {
+	config *ActionConfig
+	path   string
+}
+
+type pluginRequest struct {
+	Type   string                 `json:"type"`
+	Params map[string]interface{} `json:"params"`
+	Dir    string                 `json:"dir"`
+}
+
+type pluginResponse struct {
+	Data  json.RawMessage `json:"data"`
+	Error string          `json:"error"`
+	Log   []string        `json:"log"`
+}
+
+// Returns the path of the executable implementing the given action type,
+// searching the given directories, then the PATH.
+func findPlugin(name string, dirs []string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid plugin name: %s", name)
+	}
+	file := PluginPrefix + name
+
+	for _, dir := range dirs {
+		path, err := exec.LookPath(filepath.Join(dir, file))
+		if err == nil {
+			return filepath.Abs(path)
+		}
+	}
+	return exec.LookPath(file)
+}
+
+func (p *Plugin) Run(ctx context.Context) (*Result, error) {
+	req, err := json.Marshal(&pluginRequest{
+		Type:   p.config.Name,
+		Params: p.config.Params.AsMap(),
+		Dir:    p.config.Dir,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p.config.Log.Debugf("plugin %s", p.path)
+
+	cmd := exec.CommandContext(ctx, p.path)
+	cmd.Dir = p.config.Dir
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+	cmd.WaitDelay = time.Second
+
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdin = bytes.NewReader(req)
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if stderr := strings.TrimSpace(errBuf.String()); stderr != "" {
+		p.config.Log.Debugf("plugin %s stderr: %s", p.config.Name, stderr)
+	}
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return nil, err
+		}
+	}
+
+	var resp pluginResponse
+	if jerr := json.Unmarshal(outBuf.Bytes(), &resp); jerr != nil {
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s failed: %s: %s", p.config.Name, err.Error(), strings.TrimSpace(errBuf.String()))
+		}
+		return nil, fmt.Errorf("invalid plugin %s response: %s", p.config.Name, jerr.Error())
+	}
+
+	for _, line := range resp.Log {
+		p.config.Log.Info(line)
+	}
+
+	var r *Result
+	if len(resp.Data) > 0 && string(resp.Data) != "null" {
+		d, derr := decodeJson(resp.Data)
+		data := util.ToStringMap(d)
+		if derr != nil || data == nil {
+			return nil, fmt.Errorf("invalid plugin %s response: data must be an object", p.config.Name)
+		}
+		r = &Result{
+			Data: data,
+		}
+	} else {
+		r = &Result{
+			Data: map[string]interface{}{},
+		}
+	}
+
+	if resp.Error != "" {
+		return r, errors.New(resp.Error)
+	}
+	if err != nil {
+		return r, fmt.Errorf("plugin %s failed: %s", p.config.Name, err.Error())
+	}
+	return r, nil
+}
+
+func NewPlugin(config *ActionConfig, path string) *Plugin {
+	return &Plugin{
+		config: config,
+		path:   path,
+	}
+}
@@ -0,0 +1,85 @@
+package action
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"github.com/troykinsella/crash/util"
+	"github.com/troykinsella/crash/logging"
+)
+
+func writeTestPlugin(t *testing.T, dir string, name string, script string) {
+	path := filepath.Join(dir, PluginPrefix + name)
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n" + script + "\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crash-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestPlugin(t, dir, "echo", `printf '{"data": {"request": %s, "n": 3}, "log": ["echoing"]}' "$(cat)"`)
+	writeTestPlugin(t, dir, "fail", `cat >/dev/null; echo '{"data": {"code": 7}, "error": "it broke"}'`)
+	writeTestPlugin(t, dir, "crash", `echo oops >&2; exit 1`)
+	writeTestPlugin(t, dir, "junk", `echo not json`)
+
+	r := NewRegistry()
+	r.SetPluginDirs([]string{dir})
+
+	var tests = []struct {
+		name string
+		data map[string]interface{}
+		err  string
+	}{
+		{
+			"echo",
+			map[string]interface{}{
+				"n": 3,
+				"request": map[string]interface{}{
+					"type":   "echo",
+					"params": map[string]interface{}{"greeting": "hi"},
+					"dir":    dir,
+				},
+			},
+			"",
+		},
+		{"fail", map[string]interface{}{"code": 7}, "it broke"},
+		{"crash", nil, "plugin crash failed: exit status 1: oops"},
+		{"junk", nil, "invalid plugin junk response: invalid character 'o' in literal null (expecting 'u')"},
+		{"missing", nil, "unknown action type: missing"},
+	}
+
+	for i, test := range tests {
+		a, err := r.New(&ActionConfig{
+			Name:   test.name,
+			Params: util.AsValues(map[string]interface{}{"greeting": "hi"}),
+			Log:    logging.NewLogger(logging.L_OFF, false, false),
+			Dir:    dir,
+		})
+		var result *Result
+		if err == nil {
+			result, err = a.Run(context.Background())
+		}
+
+		if test.err == "" && err != nil {
+			t.Errorf("%d. unexpected error: %s\n", i, err.Error())
+		} else if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("%d. unexpected error:\nexpected=%s,\nactual=%v\n", i, test.err, err)
+		}
+
+		if test.data != nil {
+			if result == nil {
+				t.Errorf("%d. missing result\n", i)
+			} else if !reflect.DeepEqual(result.Data, test.data) {
+				t.Errorf("%d. unexpected data:\nexpected=%v,\nactual=%v\n", i, test.data, result.Data)
+			}
+		}
+	}
+}
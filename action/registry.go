@@ -0,0 +1,258 @@
+package action
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"github.com/troykinsella/crash/util"
+)
+
+// Creates a new action given its configuration.
+type Factory func(config *ActionConfig) Action
+
+type ParamType uint8
+
+const (
+	// A string, number, or boolean
+	STRING ParamType = iota
+	INT
+	BOOL
+	DURATION
+	// A list, or a single string, number, or boolean
+	LIST
+	MAP
+	ANY
+)
+
+var paramTypeNames = map[ParamType]string{
+	STRING:   "a string",
+	INT:      "an integer",
+	BOOL:     "a boolean",
+	DURATION: "a duration",
+	LIST:     "a list",
+	MAP:      "a map",
+	ANY:      "any value",
+}
+
+// Param describes a parameter accepted by an action.
+type Param struct {
+	Name     string
+	Type     ParamType
+	Required bool
+	Default  interface{}
+}
+
+type registration struct {
+	factory Factory
+	params  []Param
+	byName  map[string]*Param
+}
+
+// Registry maps action types to the factories that create them, along
+// with the parameters they accept.
+type Registry struct {
+	mutex      sync.RWMutex
+	actions    map[string]*registration
+	pluginDirs []string
+}
+
+// Registers an action type. When no params are given, the parameters
+// passed to the action are not validated.
+func (r *Registry) Register(name string, factory Factory, params ...Param) {
+	reg := &registration{
+		factory: factory,
+		params:  params,
+	}
+	if len(params) > 0 {
+		reg.byName = make(map[string]*Param, len(params))
+		for i := range params {
+			reg.byName[params[i].Name] = &params[i]
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.actions[name] = reg
+}
+
+// Sets the directories searched for action plugins, before the PATH, when
+// an action type isn't registered.
+func (r *Registry) SetPluginDirs(dirs []string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.pluginDirs = dirs
+}
+
+func (r *Registry) find(name string) (*registration, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	reg, ok := r.actions[name]
+	if ok {
+		return reg, nil
+	}
+
+	path, err := findPlugin(name, r.pluginDirs)
+	if err != nil {
+		return nil, fmt.Errorf("unknown action type: %s", name)
+	}
+	return &registration{
+		factory: func(c *ActionConfig) Action {
+			return NewPlugin(c, path)
+		},
+	}, nil
+}
+
+// Returns the names of the registered action types, sorted.
+func (r *Registry) Types() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, 0, len(r.actions))
+	for name := range r.actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Checks that the action type is registered or has a plugin, and that the given parameters
+// agree with those it accepts.
+func (r *Registry) Validate(name string, params map[string]interface{}) error {
+	reg, err := r.find(name)
+	if err != nil {
+		return err
+	}
+	if reg.byName == nil {
+		return nil
+	}
+
+	for _, k := range util.SortedKeysForMapStringInterface(params) {
+		p, ok := reg.byName[k]
+		if !ok {
+			return fmt.Errorf("unknown %s parameter: %s", name, k)
+		}
+		if err := p.check(params[k]); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range reg.params {
+		if p.Required && params[p.Name] == nil {
+			return fmt.Errorf("%s parameter required: %s", name, p.Name)
+		}
+	}
+
+	return nil
+}
+
+// Creates a new action of the configured type. Parameter defaults are
+// applied to the action's parameters.
+func (r *Registry) New(config *ActionConfig) (Action, error) {
+	reg, err := r.find(config.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults := make(map[string]interface{})
+	for _, p := range reg.params {
+		if p.Default != nil {
+			defaults[p.Name] = p.Default
+		}
+	}
+	if len(defaults) > 0 {
+		c := *config
+		c.Params = &defaultValues{
+			wrapped:  config.Params,
+			defaults: defaults,
+		}
+		config = &c
+	}
+
+	return reg.factory(config), nil
+}
+
+func (p *Param) check(val interface{}) error {
+	if val == nil {
+		return nil
+	}
+
+	// Interpolated values can't be known until run time
+	if s, ok := val.(string); ok && strings.Contains(s, "$") {
+		return nil
+	}
+
+	ok := true
+	switch p.Type {
+	case STRING:
+		ok = isScalar(val)
+	case INT:
+		_, err := strconv.Atoi(util.ToString(val))
+		ok = err == nil
+	case BOOL:
+		_, err := strconv.ParseBool(util.ToString(val))
+		ok = err == nil
+	case DURATION:
+		_, err := time.ParseDuration(util.ToString(val))
+		ok = err == nil
+	case LIST:
+		_, isList := val.([]interface{})
+		ok = isList || isScalar(val)
+	case MAP:
+		ok = util.ToStringMap(val) != nil
+	}
+
+	if !ok {
+		return fmt.Errorf("invalid %s parameter; expected %s: %v", p.Name, paramTypeNames[p.Type], val)
+	}
+	return nil
+}
+
+func isScalar(val interface{}) bool {
+	switch val.(type) {
+	case string, int, int64, float64, bool:
+		return true
+	}
+	return false
+}
+
+// Returns default values for parameters that are not given.
+type defaultValues struct {
+	wrapped  util.Values
+	defaults map[string]interface{}
+}
+
+func (d *defaultValues) Get(name string) interface{} {
+	val := d.wrapped.Get(name)
+	if val == nil || val == "" {
+		return d.defaults[name]
+	}
+	return val
+}
+
+func (d *defaultValues) GetString(name string) string {
+	if val := d.wrapped.GetString(name); val != "" {
+		return val
+	}
+	return util.ToString(d.defaults[name])
+}
+
+func (d *defaultValues) AsMap() map[string]interface{} {
+	result := make(map[string]interface{})
+	for k, v := range d.defaults {
+		result[k] = v
+	}
+	for k, v := range d.wrapped.AsMap() {
+		result[k] = v
+	}
+	return result
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		actions: make(map[string]*registration),
+	}
+}
@@ -0,0 +1,102 @@
+package action
+
+import (
+	"context"
+	"testing"
+	"github.com/troykinsella/crash/util"
+)
+
+type echoAction struct {
+	config *ActionConfig
+}
+
+func (e *echoAction) Run(ctx context.Context) (*Result, error) {
+	return &Result{
+		Data: map[string]interface{}{
+			"text":  e.config.Params.GetString("text"),
+			"times": e.config.Params.GetString("times"),
+		},
+	}, nil
+}
+
+func newTestRegistry() *Registry {
+	r := NewRegistry()
+	r.Register("echo", func(c *ActionConfig) Action {
+		return &echoAction{c}
+	},
+		Param{Name: "text", Type: STRING, Required: true},
+		Param{Name: "times", Type: INT, Default: 1},
+		Param{Name: "loud", Type: BOOL},
+		Param{Name: "wait", Type: DURATION},
+		Param{Name: "tags", Type: LIST},
+		Param{Name: "env", Type: MAP},
+	)
+	r.Register("free", func(c *ActionConfig) Action {
+		return &echoAction{c}
+	})
+	return r
+}
+
+func TestRegistryValidate(t *testing.T) {
+	r := newTestRegistry()
+
+	var tests = []struct {
+		name   string
+		params map[string]interface{}
+		err    string
+	}{
+		{"echo", map[string]interface{}{"text": "hi"}, ""},
+		{"echo", map[string]interface{}{"text": 42, "times": "3", "loud": true, "wait": "1s"}, ""},
+		{"echo", map[string]interface{}{"text": "hi", "tags": []interface{}{"a", "b"}, "env": map[interface{}]interface{}{"A": "b"}}, ""},
+		{"echo", map[string]interface{}{"text": "hi", "tags": "a"}, ""},
+		{"echo", map[string]interface{}{"text": "hi", "times": "${n}"}, ""},
+		{"free", map[string]interface{}{"anything": "goes"}, ""},
+
+		{"nope", map[string]interface{}{}, "unknown action type: nope"},
+		{"echo", map[string]interface{}{}, "echo parameter required: text"},
+		{"echo", map[string]interface{}{"text": "hi", "txet": "hi"}, "unknown echo parameter: txet"},
+		{"echo", map[string]interface{}{"text": "hi", "times": "many"}, "invalid times parameter; expected an integer: many"},
+		{"echo", map[string]interface{}{"text": "hi", "loud": "very"}, "invalid loud parameter; expected a boolean: very"},
+		{"echo", map[string]interface{}{"text": "hi", "wait": "5"}, "invalid wait parameter; expected a duration: 5"},
+		{"echo", map[string]interface{}{"text": "hi", "env": "A=b"}, "invalid env parameter; expected a map: A=b"},
+		{"echo", map[string]interface{}{"text": []interface{}{"hi"}}, "invalid text parameter; expected a string: [hi]"},
+	}
+
+	for i, test := range tests {
+		err := r.Validate(test.name, test.params)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%d. unexpected error: %s\n", i, err.Error())
+			}
+		} else if err == nil {
+			t.Errorf("%d. expected error:\nexpected=%s,\nactual=nil\n", i, test.err)
+		} else if err.Error() != test.err {
+			t.Errorf("%d. unexpected error:\nexpected=%s,\nactual=%s\n", i, test.err, err.Error())
+		}
+	}
+}
+
+func TestRegistryNew(t *testing.T) {
+	r := newTestRegistry()
+
+	a, err := r.New(&ActionConfig{
+		Name:   "echo",
+		Params: util.AsValues(map[string]interface{}{"text": "hi"}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err.Error())
+	}
+
+	result, _ := a.Run(context.Background())
+	if result.Data["text"] != "hi" || result.Data["times"] != "1" {
+		t.Errorf("unexpected result: %v\n", result.Data)
+	}
+
+	_, err = r.New(&ActionConfig{
+		Name:   "nope",
+		Params: util.AsValues(map[string]interface{}{}),
+	})
+	if err == nil || err.Error() != "unknown action type: nope" {
+		t.Errorf("unexpected error: %v\n", err)
+	}
+}
@@ -0,0 +1,77 @@
+package action
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"sync"
+)
+
+// An HttpSession holds the cookies and the keep-alive connection pool shared
+// by the http actions naming it.
+type HttpSession struct {
+	Jar       http.CookieJar
+	Transport *http.Transport
+}
+
+// Sessions is a scope of named sessions. A lookup that misses in this scope
+// falls back to the parent scope, and a session that does not exist in any
+// scope is created in this one.
+type Sessions struct {
+	parent *Sessions
+	mutex  sync.Mutex
+	http   map[string]*HttpSession
+}
+
+func NewSessions(parent *Sessions) *Sessions {
+	return &Sessions{
+		parent: parent,
+		http:   make(map[string]*HttpSession),
+	}
+}
+
+func (s *Sessions) find(name string) *HttpSession {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if hs := s.http[name]; hs != nil {
+		return hs
+	}
+	if s.parent != nil {
+		return s.parent.find(name)
+	}
+	return nil
+}
+
+// Returns the named http session, creating it with the given transport
+// if it doesn't exist.
+func (s *Sessions) Http(name string, newTransport func() *http.Transport) *HttpSession {
+	if hs := s.find(name); hs != nil {
+		return hs
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Another goroutine may have won the race
+	if hs := s.http[name]; hs != nil {
+		return hs
+	}
+
+	jar, _ := cookiejar.New(nil)
+	hs := &HttpSession{
+		Jar:       jar,
+		Transport: newTransport(),
+	}
+	s.http[name] = hs
+	return hs
+}
+
+// Releases the idle connections held by the sessions in this scope.
+func (s *Sessions) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, hs := range s.http {
+		hs.Transport.CloseIdleConnections()
+	}
+}
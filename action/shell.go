@@ -1,43 +1,125 @@
 package action
 
 import (
+	"context"
+	"os"
 	"os/exec"
 	"fmt"
 	"bytes"
 	"strings"
+	"sync"
+	"time"
+	"github.com/troykinsella/crash/util"
 )
 
 type Shell struct {
 	config *ActionConfig
 }
 
-func (s *Shell) Run() (*Result, error) {
+var shellParams = []Param{
+	{Name: "command", Type: STRING, Required: true},
+	{Name: "shell", Type: LIST, Default: "sh"},
+	{Name: "env", Type: MAP},
+	{Name: "dir", Type: STRING},
+	{Name: "stdin", Type: STRING},
+}
+
+// Writes into its own buffer, and into a buffer shared with other
+// writers, preserving the order of interleaved writes.
+type teeWriter struct {
+	mutex    *sync.Mutex
+	buf      bytes.Buffer
+	combined *bytes.Buffer
+}
+
+func (w *teeWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.buf.Write(p)
+	return w.combined.Write(p)
+}
+
+// Returns the interpreter command line, to which the command string is appended.
+func (s *Shell) interpreter() []string {
+	switch sh := s.config.Params.Get("shell").(type) {
+	case []interface{}:
+		return formValues(sh)
+	case string:
+		args := strings.Fields(sh)
+		if len(args) == 1 {
+			args = append(args, "-c")
+		}
+		if len(args) > 0 {
+			return args
+		}
+	}
+	return []string{"sh", "-c"}
+}
+
+func (s *Shell) Run(ctx context.Context) (*Result, error) {
 	str := s.config.Params.GetString("command")
 	if str == "" {
 		return nil, fmt.Errorf("command parameter required")
 	}
 	s.config.Log.Info(str)
 
-	cmd := exec.Command("sh", "-c", str)
-	var outBuf bytes.Buffer
-	cmd.Stdout = &outBuf
+	args := append(s.interpreter(), str)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = s.config.Path(s.config.Params.GetString("dir"))
 
-	var errBuf bytes.Buffer
-	cmd.Stderr = &errBuf
+	// Run the command in its own process group so that, when the context
+	// is done, its children are killed with it
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+	cmd.WaitDelay = time.Second
 
+	if env := util.ToStringMap(s.config.Params.Get("env")); len(env) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range env {
+			cmd.Env = append(cmd.Env, k + "=" + util.ToString(v))
+		}
+	}
+
+	if stdin := s.config.Params.GetString("stdin"); stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+
+	var mutex sync.Mutex
+	var combined bytes.Buffer
+	outW := &teeWriter{mutex: &mutex, combined: &combined}
+	errW := &teeWriter{mutex: &mutex, combined: &combined}
+	cmd.Stdout = outW
+	cmd.Stderr = errW
+
+	exitCode := 0
 	err := cmd.Run()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	if err != nil {
-		return nil, err
+		ee, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, err
+		}
+		exitCode = ee.ExitCode()
 	}
 
-	r := s.genResult(outBuf, errBuf)
+	r := s.genResult(outW.buf, errW.buf, combined, exitCode)
+	if exitCode != 0 {
+		return r, fmt.Errorf("command exited with status %d", exitCode)
+	}
 	return r, nil
 }
 
-func (s *Shell) genResult(outBuf bytes.Buffer, errBuf bytes.Buffer) *Result {
+func (s *Shell) genResult(outBuf bytes.Buffer, errBuf bytes.Buffer, combinedBuf bytes.Buffer, exitCode int) *Result {
 	data := make(map[string]interface{})
 	data["out"] = strings.TrimSpace(outBuf.String())
 	data["err"] = strings.TrimSpace(errBuf.String())
+	data["output"] = strings.TrimSpace(combinedBuf.String())
+	data["exit-code"] = exitCode
 
 	return &Result{
 		Data:    data,
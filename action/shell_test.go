@@ -0,0 +1,139 @@
+package action
+
+import (
+	"context"
+	"testing"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+	"github.com/troykinsella/crash/util"
+	"github.com/troykinsella/crash/logging"
+)
+
+func TestShell(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crash-shell")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+
+	var tests = []struct {
+		params   map[string]interface{}
+		out      string
+		err      string
+		output   string
+		exitCode int
+	}{
+		{
+			map[string]interface{}{"command": "echo foo"},
+			"foo", "", "foo", 0,
+		},
+		{
+			map[string]interface{}{"command": "echo a; sleep 0.1; echo b >&2; sleep 0.1; echo c; exit 3"},
+			"a\nc", "b", "a\nb\nc", 3,
+		},
+		{
+			map[string]interface{}{
+				"command": "echo $FOO $BAR",
+				"env":     map[interface{}]interface{}{"FOO": "foo", "BAR": 42},
+			},
+			"foo 42", "", "foo 42", 0,
+		},
+		{
+			map[string]interface{}{
+				"command": "basename $(pwd)",
+				"dir":     "sub",
+			},
+			"sub", "", "sub", 0,
+		},
+		{
+			map[string]interface{}{
+				"command": "tr a-z A-Z",
+				"stdin":   "hello",
+			},
+			"HELLO", "", "HELLO", 0,
+		},
+		{
+			map[string]interface{}{
+				"command": "echo $0",
+				"shell":   "sh",
+			},
+			"sh", "", "sh", 0,
+		},
+		{
+			map[string]interface{}{
+				"command": "echo foo",
+				"shell":   []interface{}{"sh", "-e", "-c"},
+			},
+			"foo", "", "foo", 0,
+		},
+	}
+
+	for i, test := range tests {
+		a := NewShell(&ActionConfig{
+			Name:   "shell",
+			Params: util.AsValues(test.params),
+			Log:    logging.NewLogger(logging.L_OFF, false, false),
+			Dir:    dir,
+		})
+
+		r, err := a.Run(context.Background())
+		if (err != nil) != (test.exitCode != 0) {
+			t.Errorf("%d. unexpected error: %v\n", i, err)
+		}
+		if r == nil {
+			continue
+		}
+
+		if r.Data["out"] != test.out {
+			t.Errorf("%d. unexpected out:\nexpected=%q,\nactual=%q\n", i, test.out, r.Data["out"])
+		}
+		if r.Data["err"] != test.err {
+			t.Errorf("%d. unexpected err:\nexpected=%q,\nactual=%q\n", i, test.err, r.Data["err"])
+		}
+		if r.Data["output"] != test.output {
+			t.Errorf("%d. unexpected output:\nexpected=%q,\nactual=%q\n", i, test.output, r.Data["output"])
+		}
+		if r.Data["exit-code"] != test.exitCode {
+			t.Errorf("%d. unexpected exit-code:\nexpected=%d,\nactual=%v\n", i, test.exitCode, r.Data["exit-code"])
+		}
+	}
+}
+
+func TestShellCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crash-shell")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	marker := filepath.Join(dir, "marker")
+
+	// The background child would create the marker file, were it not
+	// killed along with the shell
+	a := NewShell(&ActionConfig{
+		Name: "shell",
+		Params: util.AsValues(map[string]interface{}{
+			"command": "(sleep 1; touch " + marker + ") & wait",
+		}),
+		Log: logging.NewLogger(logging.L_OFF, false, false),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100 * time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = a.Run(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("unexpected error: %v\n", err)
+	}
+	if d := time.Since(start); d > 500 * time.Millisecond {
+		t.Errorf("command was not stopped: %s\n", d)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("child process was not killed\n")
+	}
+}
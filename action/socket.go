@@ -0,0 +1,259 @@
+package action
+
+import (
+	"context"
+	"bytes"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Socket sends a payload over a raw TCP or UDP socket, then reads the
+// response until a delimiter, a byte count, the read timeout, or the end
+// of the stream.
+type Socket struct {
+	config  *ActionConfig
+	network string
+}
+
+var tcpParams = append(append([]Param{
+	{Name: "tls", Type: BOOL},
+}, udpParams...), tlsParams...)
+
+var udpParams = []Param{
+	{Name: "address", Type: STRING, Required: true},
+	{Name: "send", Type: STRING},
+	{Name: "send_hex", Type: STRING},
+	{Name: "until", Type: STRING},
+	{Name: "until_hex", Type: STRING},
+	{Name: "read_bytes", Type: INT},
+	{Name: "read_timeout", Type: DURATION},
+}
+
+func (s *Socket) payload() ([]byte, error) {
+	p := s.config.Params
+	text := p.GetString("send")
+	hexText := p.GetString("send_hex")
+
+	if text != "" && hexText != "" {
+		return nil, fmt.Errorf("send and send_hex parameters are mutually exclusive")
+	}
+	if hexText != "" {
+		b, err := hex.DecodeString(hexText)
+		if err != nil {
+			return nil, fmt.Errorf("invalid send_hex parameter: %s", err.Error())
+		}
+		return b, nil
+	}
+	return []byte(text), nil
+}
+
+func (s *Socket) delimiter() ([]byte, error) {
+	p := s.config.Params
+	text := p.GetString("until")
+	hexText := p.GetString("until_hex")
+
+	if text != "" && hexText != "" {
+		return nil, fmt.Errorf("until and until_hex parameters are mutually exclusive")
+	}
+	if hexText != "" {
+		b, err := hex.DecodeString(hexText)
+		if err != nil {
+			return nil, fmt.Errorf("invalid until_hex parameter: %s", err.Error())
+		}
+		return b, nil
+	}
+	return []byte(text), nil
+}
+
+func (s *Socket) dial(ctx context.Context, address string) (net.Conn, map[string]interface{}, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	useTls := false
+	if t := s.config.Params.GetString("tls"); t != "" {
+		useTls, err = strconv.ParseBool(t)
+		if err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("invalid tls parameter: %s", t)
+		}
+	}
+	if !useTls {
+		return conn, nil, nil
+	}
+	if s.network != "tcp" {
+		conn.Close()
+		return nil, nil, fmt.Errorf("tls is only supported over tcp")
+	}
+
+	config, err := newTlsConfig(s.config)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		host, _, _ := net.SplitHostPort(address)
+		config.ServerName = host
+	}
+
+	tc := tls.Client(conn, config)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	state := tc.ConnectionState()
+	return tc, genTlsResult(&state), nil
+}
+
+func (s *Socket) Run(ctx context.Context) (*Result, error) {
+	p := s.config.Params
+
+	address := p.GetString("address")
+	if address == "" {
+		return nil, fmt.Errorf("address parameter required")
+	}
+
+	payload, err := s.payload()
+	if err != nil {
+		return nil, err
+	}
+
+	until, err := s.delimiter()
+	if err != nil {
+		return nil, err
+	}
+
+	readBytes := 0
+	if n := p.GetString("read_bytes"); n != "" {
+		readBytes, err = strconv.Atoi(n)
+		if err != nil || readBytes <= 0 {
+			return nil, fmt.Errorf("invalid read_bytes parameter: %s", n)
+		}
+	}
+
+	var readTimeout time.Duration
+	if t := p.GetString("read_timeout"); t != "" {
+		readTimeout, err = time.ParseDuration(t)
+		if err != nil || readTimeout <= 0 {
+			return nil, fmt.Errorf("invalid read_timeout parameter: %s", t)
+		}
+	}
+
+	s.config.Log.Debugf("%s %s", s.network, address)
+
+	start := time.Now()
+	conn, tlsResult, err := s.dial(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	connected := time.Now()
+
+	// Unblock reads and writes when the context is done
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	if len(payload) > 0 {
+		if _, err := conn.Write(payload); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+	}
+	sent := time.Now()
+
+	if readTimeout > 0 {
+		conn.SetReadDeadline(sent.Add(readTimeout))
+	}
+
+	var received bytes.Buffer
+	var firstByte time.Time
+	matched := false
+	timedOut := false
+	chunk := make([]byte, 64*1024)
+
+	for {
+		n, err := conn.Read(chunk)
+		if n > 0 {
+			if firstByte.IsZero() {
+				firstByte = time.Now()
+			}
+			received.Write(chunk[:n])
+		}
+
+		if len(until) > 0 {
+			if i := bytes.Index(received.Bytes(), until); i >= 0 {
+				received.Truncate(i + len(until))
+				matched = true
+				break
+			}
+		}
+		if readBytes > 0 && received.Len() >= readBytes {
+			received.Truncate(readBytes)
+			break
+		}
+		if s.network == "udp" && n > 0 && len(until) == 0 && readBytes == 0 {
+			// A single datagram is the whole response
+			break
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				timedOut = true
+			} else if err != io.EOF {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	s.config.Log.Infof("%s %s -> %d bytes", s.network, address, received.Len())
+
+	b := received.Bytes()
+	data := map[string]interface{}{
+		"data":          string(b),
+		"hex":           hex.EncodeToString(b),
+		"length":        len(b),
+		"matched":       matched,
+		"timed-out":     timedOut,
+		"connect-time":  millis(start, connected),
+		"response-time": millis(sent, firstByte),
+	}
+	if tlsResult != nil {
+		data["tls"] = tlsResult
+	}
+
+	return &Result{
+		Data: data,
+	}, nil
+}
+
+func NewTcp(config *ActionConfig) *Socket {
+	return &Socket{
+		config:  config,
+		network: "tcp",
+	}
+}
+
+func NewUdp(config *ActionConfig) *Socket {
+	return &Socket{
+		config:  config,
+		network: "udp",
+	}
+}
@@ -0,0 +1,123 @@
+package action
+
+import (
+	"context"
+	"testing"
+	"net"
+	"bufio"
+	"github.com/troykinsella/crash/util"
+	"github.com/troykinsella/crash/logging"
+)
+
+func newTestSocket(network string, params map[string]interface{}) *Socket {
+	config := &ActionConfig{
+		Name: network,
+		Params: util.AsValues(params),
+		Log: logging.NewLogger(logging.L_OFF, false, false),
+	}
+	if network == "udp" {
+		return NewUdp(config)
+	}
+	return NewTcp(config)
+}
+
+func TestTcp(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// Replies to "PING" lines with "+PONG", then more junk, keeping the connection open,
+	// and closes the connection on "QUIT".
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch line {
+					case "PING\r\n":
+						conn.Write([]byte("+PONG\r\n+MORE\r\n"))
+					case "QUIT\r\n":
+						conn.Write([]byte("+BYE\r\n"))
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	var tests = []struct {
+		params   map[string]interface{}
+		data     string
+		matched  bool
+		timedOut bool
+	}{
+		{ map[string]interface{}{ "send": "PING\r\n", "until": "\r\n" }, "+PONG\r\n", true, false },
+		{ map[string]interface{}{ "send_hex": "50494e470d0a", "until_hex": "0d0a" }, "+PONG\r\n", true, false },
+		{ map[string]interface{}{ "send": "PING\r\n", "read_bytes": 3 }, "+PO", false, false },
+		{ map[string]interface{}{ "send": "QUIT\r\n" }, "+BYE\r\n", false, false },
+		{ map[string]interface{}{ "send": "NOPE\r\n", "read_timeout": "50ms" }, "", false, true },
+	}
+
+	for i, test := range tests {
+		test.params["address"] = l.Addr().String()
+		r, err := newTestSocket("tcp", test.params).Run(context.Background())
+		if err != nil {
+			t.Errorf("%d. unexpected error: %s\n", i, err.Error())
+			continue
+		}
+		if r.Data["data"] != test.data {
+			t.Errorf("%d. unexpected data:\nexpected=%q,\nactual=%q\n", i, test.data, r.Data["data"])
+		}
+		if r.Data["matched"] != test.matched {
+			t.Errorf("%d. unexpected matched: %v\n", i, r.Data["matched"])
+		}
+		if r.Data["timed-out"] != test.timedOut {
+			t.Errorf("%d. unexpected timed-out: %v\n", i, r.Data["timed-out"])
+		}
+	}
+}
+
+func TestUdp(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(append([]byte("echo:"), buf[:n]...), addr)
+		}
+	}()
+
+	r, err := newTestSocket("udp", map[string]interface{}{
+		"address": pc.LocalAddr().String(),
+		"send": "hello",
+		"read_timeout": "1s",
+	}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err.Error())
+	}
+	if r.Data["data"] != "echo:hello" {
+		t.Errorf("unexpected data: %q\n", r.Data["data"])
+	}
+	if r.Data["hex"] != "6563686f3a68656c6c6f" {
+		t.Errorf("unexpected hex: %v\n", r.Data["hex"])
+	}
+}
@@ -0,0 +1,203 @@
+package action
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"github.com/troykinsella/crash/util"
+	_ "modernc.org/sqlite"
+)
+
+const defaultSqlDriver = "sqlite"
+
+var sqlParams = []Param{
+	{Name: "driver", Type: STRING, Default: defaultSqlDriver},
+	{Name: "dsn", Type: STRING, Required: true},
+	{Name: "query", Type: STRING, Required: true},
+	{Name: "args", Type: ANY},
+}
+
+// Sql runs a query or statement against a database. The driver must be
+// registered with database/sql; SQLite is built in, without cgo, so that it
+// works in cross-compiled binaries.
+type Sql struct {
+	config *ActionConfig
+}
+
+// Returns whether the statement produces rows, judging by its first keyword.
+func isSqlQuery(query string) bool {
+	fields := strings.Fields(strings.ToLower(query))
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.TrimLeft(fields[0], "(") {
+	case "select", "with", "pragma", "values", "explain", "show", "describe":
+		return true
+	}
+	for _, f := range fields {
+		if f == "returning" {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the values bound to the placeholders of the query, given by the
+// args parameter as either a list, bound in order, or a map of named values.
+func (s *Sql) args() []interface{} {
+	a := s.config.Params.Get("args")
+	if a == nil || a == "" {
+		return nil
+	}
+	if list, ok := a.([]interface{}); ok {
+		return list
+	}
+	if m := util.ToStringMap(a); m != nil {
+		args := make([]interface{}, 0, len(m))
+		for _, k := range util.SortedKeysForMapStringInterface(m) {
+			args = append(args, sql.Named(k, m[k]))
+		}
+		return args
+	}
+	return []interface{}{a}
+}
+
+func (s *Sql) driver() string {
+	d := s.config.Params.GetString("driver")
+	// The name of the cgo SQLite driver is accepted for the built-in one
+	if d == "" || d == "sqlite3" {
+		return defaultSqlDriver
+	}
+	return d
+}
+
+func (s *Sql) dsn() string {
+	dsn := s.config.Params.GetString("dsn")
+	if s.driver() != defaultSqlDriver {
+		return dsn
+	}
+	// A SQLite database file is resolved like other files
+	if dsn == ":memory:" || strings.HasPrefix(dsn, "file:") {
+		return dsn
+	}
+	return s.config.Path(dsn)
+}
+
+func (s *Sql) Run(ctx context.Context) (*Result, error) {
+	p := s.config.Params
+
+	driver := s.driver()
+	if p.GetString("dsn") == "" {
+		return nil, fmt.Errorf("dsn parameter required")
+	}
+	query := p.GetString("query")
+	if query == "" {
+		return nil, fmt.Errorf("query parameter required")
+	}
+
+	args := s.args()
+
+	db, err := sql.Open(driver, s.dsn())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	s.config.Log.Info(query)
+
+	start := time.Now()
+	data := map[string]interface{}{
+		"rows":          []interface{}{},
+		"columns":       []interface{}{},
+		"row-count":     0,
+		"rows-affected": 0,
+	}
+
+	if isSqlQuery(query) {
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		columns, list, err := scanSqlRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		data["columns"] = columns
+		data["rows"] = list
+		data["row-count"] = len(list)
+		if len(list) > 0 {
+			data["row"] = list[0]
+		}
+	} else {
+		result, err := db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := result.RowsAffected(); err == nil {
+			data["rows-affected"] = int(n)
+		}
+		if id, err := result.LastInsertId(); err == nil {
+			data["last-insert-id"] = int(id)
+		}
+	}
+	data["time"] = millis(start, time.Now())
+
+	s.config.Log.Infof("%s -> %d rows, %d affected", driver, data["row-count"], data["rows-affected"])
+
+	return &Result{
+		Data: data,
+	}, nil
+}
+
+func scanSqlRows(rows *sql.Rows) ([]interface{}, []interface{}, error) {
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	columns := make([]interface{}, len(names))
+	for i, n := range names {
+		columns[i] = n
+	}
+
+	list := make([]interface{}, 0)
+	for rows.Next() {
+		vals := make([]interface{}, len(names))
+		ptrs := make([]interface{}, len(names))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, nil, err
+		}
+
+		row := make(map[string]interface{}, len(names))
+		for i, n := range names {
+			row[n] = normalizeSqlValue(vals[i])
+		}
+		list = append(list, row)
+	}
+	return columns, list, rows.Err()
+}
+
+// Converts a scanned column value into one that checks can compare.
+func normalizeSqlValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case []byte:
+		return string(v)
+	case int64:
+		return int(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return val
+}
+
+func NewSql(config *ActionConfig) *Sql {
+	return &Sql{
+		config: config,
+	}
+}
@@ -0,0 +1,128 @@
+package action
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"github.com/troykinsella/crash/util"
+	"github.com/troykinsella/crash/logging"
+)
+
+func TestSql(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crash-sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var tests = []struct {
+		query        string
+		args         interface{}
+		rows         []interface{}
+		rowsAffected int
+	}{
+		{
+			"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, score REAL)",
+			nil, []interface{}{}, 0,
+		},
+		{
+			"INSERT INTO users (name, score) VALUES (?, ?), (?, ?)",
+			[]interface{}{"alice", 1.5, "bob", 2},
+			[]interface{}{}, 2,
+		},
+		{
+			"SELECT id, name, score FROM users ORDER BY id",
+			nil,
+			[]interface{}{
+				map[string]interface{}{"id": 1, "name": "alice", "score": 1.5},
+				map[string]interface{}{"id": 2, "name": "bob", "score": 2.0},
+			},
+			0,
+		},
+		{
+			"SELECT name FROM users WHERE id = ?",
+			"2",
+			[]interface{}{
+				map[string]interface{}{"name": "bob"},
+			},
+			0,
+		},
+		{
+			"UPDATE users SET score = score + 1 WHERE name = :name",
+			map[interface{}]interface{}{"name": "alice"},
+			[]interface{}{}, 1,
+		},
+		{
+			"  with s AS (SELECT score FROM users WHERE name = @name) SELECT score FROM s",
+			map[string]interface{}{"name": "alice"},
+			[]interface{}{
+				map[string]interface{}{"score": 2.5},
+			},
+			0,
+		},
+		{
+			"DELETE FROM users RETURNING name",
+			nil,
+			[]interface{}{
+				map[string]interface{}{"name": "alice"},
+				map[string]interface{}{"name": "bob"},
+			},
+			0,
+		},
+	}
+
+	for i, test := range tests {
+		a := NewSql(&ActionConfig{
+			Name: "sql",
+			Params: util.AsValues(map[string]interface{}{
+				"dsn":   "test.db",
+				"query": test.query,
+				"args":  test.args,
+			}),
+			Log: logging.NewLogger(logging.L_OFF, false, false),
+			Dir: dir,
+		})
+
+		r, err := a.Run(context.Background())
+		if err != nil {
+			t.Errorf("%d. unexpected error: %s\n", i, err.Error())
+			continue
+		}
+
+		if !reflect.DeepEqual(r.Data["rows"], test.rows) {
+			t.Errorf("%d. unexpected rows:\nexpected=%v,\nactual=%v\n", i, test.rows, r.Data["rows"])
+		}
+		if r.Data["row-count"] != len(test.rows) {
+			t.Errorf("%d. unexpected row-count: %v\n", i, r.Data["row-count"])
+		}
+		if r.Data["rows-affected"] != test.rowsAffected {
+			t.Errorf("%d. unexpected rows-affected:\nexpected=%d,\nactual=%v\n", i, test.rowsAffected, r.Data["rows-affected"])
+		}
+	}
+}
+
+func TestSqlDriver(t *testing.T) {
+	for i, driver := range []string{"", "sqlite", "sqlite3"} {
+		a := NewSql(&ActionConfig{
+			Name: "sql",
+			Params: util.AsValues(map[string]interface{}{
+				"driver": driver,
+				"dsn":    ":memory:",
+				"query":  "SELECT 1 AS one",
+			}),
+			Log: logging.NewLogger(logging.L_OFF, false, false),
+		})
+
+		r, err := a.Run(context.Background())
+		if err != nil {
+			t.Errorf("%d. unexpected error: %s\n", i, err.Error())
+			continue
+		}
+		expected := map[string]interface{}{"one": 1}
+		if !reflect.DeepEqual(r.Data["row"], expected) {
+			t.Errorf("%d. unexpected row:\nexpected=%v,\nactual=%v\n", i, expected, r.Data["row"])
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package action
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sse reads a stream of Server-Sent Events from an HTTP server. The request
+// is made just like the http action's, and the stream is read until the
+// event count is reached, an event matches, the read timeout elapses, or the
+// server ends the stream.
+type Sse struct {
+	http *Http
+}
+
+type sseEvent struct {
+	id    string
+	event string
+	data  []string
+}
+
+func (e *sseEvent) result() map[string]interface{} {
+	data := strings.Join(e.data, "\n")
+	event := e.event
+	if event == "" {
+		event = "message"
+	}
+
+	r := map[string]interface{}{
+		"id":    e.id,
+		"event": event,
+		"data":  data,
+	}
+	if j, err := decodeJson([]byte(data)); err == nil {
+		r["json"] = j
+	}
+	return r
+}
+
+var sseParams = append([]Param{
+	{Name: "count", Type: INT},
+	{Name: "until", Type: STRING},
+	{Name: "until_event", Type: STRING},
+	{Name: "read_timeout", Type: DURATION},
+}, httpParams...)
+
+func (s *Sse) Run(ctx context.Context) (*Result, error) {
+	p := s.http.config.Params
+
+	count := 0
+	if c := p.GetString("count"); c != "" {
+		n, err := strconv.Atoi(c)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid count parameter: %s", c)
+		}
+		count = n
+	}
+
+	var readTimeout time.Duration
+	if t := p.GetString("read_timeout"); t != "" {
+		d, err := time.ParseDuration(t)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid read_timeout parameter: %s", t)
+		}
+		readTimeout = d
+	}
+
+	until := p.GetString("until")
+	untilEvent := p.GetString("until_event")
+
+	readCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resp, timer, _, err := s.http.do(readCtx)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var readTimer *time.Timer
+	if readTimeout > 0 {
+		readTimer = time.AfterFunc(readTimeout, cancel)
+	}
+
+	events := make([]interface{}, 0)
+	matched := false
+	var firstEvent time.Time
+
+	sc := bufio.NewScanner(resp.Body)
+	ev := &sseEvent{}
+
+	for sc.Scan() {
+		line := sc.Text()
+
+		if line == "" {
+			// Dispatch
+			if len(ev.data) == 0 {
+				ev = &sseEvent{}
+				continue
+			}
+			if firstEvent.IsZero() {
+				firstEvent = time.Now()
+			}
+
+			r := ev.result()
+			events = append(events, r)
+			s.http.config.Log.Debugf("event %s: %s", r["event"], r["data"])
+
+			if (until != "" && strings.Contains(r["data"].(string), until)) ||
+				(untilEvent != "" && r["event"] == untilEvent) {
+				matched = true
+				break
+			}
+			if count > 0 && len(events) >= count {
+				break
+			}
+
+			ev = &sseEvent{}
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue // Comment
+		}
+
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field = line[:i]
+			value = strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "id":
+			ev.id = value
+		case "event":
+			ev.event = value
+		case "data":
+			ev.data = append(ev.data, value)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	// The timer has fired if it can't be stopped
+	timedOut := readTimer != nil && !readTimer.Stop()
+
+	if err := sc.Err(); err != nil && !timedOut {
+		return nil, err
+	}
+
+	s.http.config.Log.Infof("%s %s -> %d, %d events", resp.Request.Method, resp.Request.URL.String(), resp.StatusCode, len(events))
+
+	data := map[string]interface{}{
+		"status-code":         resp.StatusCode,
+		"headers":             resp.Header,
+		"events":              events,
+		"event-count":         len(events),
+		"matched":             matched,
+		"timed-out":           timedOut,
+		"time-to-first-event": millis(timer.start, firstEvent),
+	}
+
+	return &Result{
+		Data: data,
+	}, nil
+}
+
+func NewSse(config *ActionConfig) *Sse {
+	h := NewHttp(config)
+	h.defaultHeaders = http.Header{
+		"Accept": []string{"text/event-stream"},
+	}
+	return &Sse{
+		http: h,
+	}
+}
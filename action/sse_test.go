@@ -0,0 +1,88 @@
+package action
+
+import (
+	"context"
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"fmt"
+	"time"
+	"github.com/troykinsella/crash/util"
+	"github.com/troykinsella/crash/logging"
+)
+
+func TestSse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "text/event-stream" {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		f := w.(http.Flusher)
+
+		fmt.Fprint(w, ": comment\n\n")
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "id: %d\nevent: tick\ndata: {\"n\": %d}\n\n", i, i)
+			f.Flush()
+		}
+		fmt.Fprint(w, "event: done\ndata: bye\ndata: now\n\n")
+		f.Flush()
+
+		// Hang until the client goes away
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	var tests = []struct {
+		params   map[string]interface{}
+		count    int
+		matched  bool
+		timedOut bool
+	}{
+		{ map[string]interface{}{ "count": 2 }, 2, false, false },
+		{ map[string]interface{}{ "until": "\"n\": 1" }, 2, true, false },
+		{ map[string]interface{}{ "until_event": "done" }, 4, true, false },
+		{ map[string]interface{}{ "read_timeout": "100ms" }, 4, false, true },
+	}
+
+	for i, test := range tests {
+		test.params["url"] = ts.URL
+		a := NewSse(&ActionConfig{
+			Name: "sse",
+			Params: util.AsValues(test.params),
+			Log: logging.NewLogger(logging.L_OFF, false, false),
+		})
+
+		start := time.Now()
+		r, err := a.Run(context.Background())
+		if err != nil {
+			t.Errorf("%d. unexpected error: %s\n", i, err.Error())
+			continue
+		}
+		if time.Since(start) > 5 * time.Second {
+			t.Errorf("%d. took too long\n", i)
+		}
+
+		if r.Data["event-count"] != test.count {
+			t.Errorf("%d. unexpected event count:\nexpected=%d,\nactual=%v\n", i, test.count, r.Data["event-count"])
+		}
+		if r.Data["matched"] != test.matched {
+			t.Errorf("%d. unexpected matched: %v\n", i, r.Data["matched"])
+		}
+		if r.Data["timed-out"] != test.timedOut {
+			t.Errorf("%d. unexpected timed-out: %v\n", i, r.Data["timed-out"])
+		}
+
+		events := r.Data["events"].([]interface{})
+		first := events[0].(map[string]interface{})
+		if first["id"] != "0" || first["event"] != "tick" {
+			t.Errorf("%d. unexpected first event: %v\n", i, first)
+		}
+		if first["json"].(map[string]interface{})["n"] != 0 {
+			t.Errorf("%d. unexpected first event json: %v\n", i, first["json"])
+		}
+		if len(events) == 4 && events[3].(map[string]interface{})["data"] != "bye\nnow" {
+			t.Errorf("%d. unexpected last event: %v\n", i, events[3])
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package action
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/troykinsella/crash/util"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebSocket connects to a WebSocket server, sends a scripted sequence of
+// frames, then collects the messages received until the message count is
+// reached, a message matches, the read timeout elapses, or the server
+// closes the connection.
+type WebSocket struct {
+	config *ActionConfig
+}
+
+var webSocketParams = append([]Param{
+	{Name: "url", Type: STRING, Required: true},
+	{Name: "headers", Type: MAP},
+	{Name: "subprotocols", Type: LIST},
+	{Name: "send", Type: ANY},
+	{Name: "count", Type: INT},
+	{Name: "until", Type: STRING},
+	{Name: "read_timeout", Type: DURATION},
+}, tlsParams...)
+
+type wsFrame struct {
+	messageType int
+	data        []byte
+}
+
+// Returns the frame described by an entry of the send parameter, which is
+// either a string, sent as text, or a map having one of "text", "binary"
+// (base64 encoded) or "json" keys.
+func newWsFrame(val interface{}) (*wsFrame, error) {
+	if s, ok := val.(string); ok {
+		return &wsFrame{websocket.TextMessage, []byte(s)}, nil
+	}
+
+	m := util.ToStringMap(val)
+	switch {
+	case m == nil:
+	case m["text"] != nil:
+		return &wsFrame{websocket.TextMessage, []byte(util.ToString(m["text"]))}, nil
+	case m["binary"] != nil:
+		b, err := base64.StdEncoding.DecodeString(util.ToString(m["binary"]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 binary frame: %s", err.Error())
+		}
+		return &wsFrame{websocket.BinaryMessage, b}, nil
+	case m["json"] != nil:
+		b, err := json.Marshal(m["json"])
+		if err != nil {
+			return nil, err
+		}
+		return &wsFrame{websocket.TextMessage, b}, nil
+	}
+
+	return nil, fmt.Errorf("invalid frame; expected a string, or a map having a text, binary, or json key")
+}
+
+func (w *WebSocket) frames() ([]*wsFrame, error) {
+	send := w.config.Params.Get("send")
+	if send == nil || send == "" {
+		return nil, nil
+	}
+
+	list, ok := send.([]interface{})
+	if !ok {
+		list = []interface{}{send}
+	}
+
+	frames := make([]*wsFrame, len(list))
+	for i, val := range list {
+		f, err := newWsFrame(val)
+		if err != nil {
+			return nil, err
+		}
+		frames[i] = f
+	}
+	return frames, nil
+}
+
+func (w *WebSocket) Run(ctx context.Context) (*Result, error) {
+	p := w.config.Params
+
+	url := p.GetString("url")
+	if url == "" {
+		return nil, fmt.Errorf("url parameter required")
+	}
+
+	count := 0
+	if c := p.GetString("count"); c != "" {
+		n, err := strconv.Atoi(c)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid count parameter: %s", c)
+		}
+		count = n
+	}
+
+	var readTimeout time.Duration
+	if t := p.GetString("read_timeout"); t != "" {
+		d, err := time.ParseDuration(t)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid read_timeout parameter: %s", t)
+		}
+		readTimeout = d
+	}
+
+	until := p.GetString("until")
+
+	frames, err := w.frames()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := newTlsConfig(w.config)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 45 * time.Second,
+		TLSClientConfig:  tlsConfig,
+	}
+	if sp := p.Get("subprotocols"); sp != nil && sp != "" {
+		dialer.Subprotocols = formValues(sp)
+	}
+
+	header := http.Header{}
+	setHeaders(p, header)
+
+	w.config.Log.Debugf("CONNECT %s", url)
+
+	start := time.Now()
+	conn, resp, err := dialer.DialContext(ctx, url, header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("%s: handshake status %d", err.Error(), resp.StatusCode)
+		}
+		return nil, err
+	}
+	defer conn.Close()
+	connected := time.Now()
+
+	// Unblock reads and writes when the context is done
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	for _, f := range frames {
+		if err := conn.WriteMessage(f.messageType, f.data); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+	}
+
+	if readTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+	}
+
+	messages := make([]interface{}, 0)
+	matched := false
+	timedOut := false
+	closeCode := 0
+	closeReason := ""
+	var firstMessage time.Time
+
+	for count == 0 || len(messages) < count {
+		mt, b, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if ce, ok := err.(*websocket.CloseError); ok {
+				closeCode = ce.Code
+				closeReason = ce.Text
+			} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				timedOut = true
+			} else {
+				return nil, err
+			}
+			break
+		}
+		if firstMessage.IsZero() {
+			firstMessage = time.Now()
+		}
+
+		m := map[string]interface{}{
+			"data": string(b),
+		}
+		if mt == websocket.BinaryMessage {
+			m["type"] = "binary"
+		} else {
+			m["type"] = "text"
+			if j, err := decodeJson(b); err == nil {
+				m["json"] = j
+			}
+		}
+		messages = append(messages, m)
+		w.config.Log.Debugf("message %s: %s", m["type"], m["data"])
+
+		if until != "" && strings.Contains(string(b), until) {
+			matched = true
+			break
+		}
+	}
+
+	if closeCode == 0 {
+		// Close politely
+		msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	}
+
+	w.config.Log.Infof("%s -> %d messages", url, len(messages))
+
+	data := map[string]interface{}{
+		"status-code":           resp.StatusCode,
+		"headers":               resp.Header,
+		"subprotocol":           conn.Subprotocol(),
+		"messages":              messages,
+		"message-count":         len(messages),
+		"matched":               matched,
+		"timed-out":             timedOut,
+		"close-code":            closeCode,
+		"close-reason":          closeReason,
+		"connect-time":          millis(start, connected),
+		"time-to-first-message": millis(connected, firstMessage),
+	}
+	if tc, ok := conn.UnderlyingConn().(*tls.Conn); ok {
+		state := tc.ConnectionState()
+		data["tls"] = genTlsResult(&state)
+	}
+
+	return &Result{
+		Data: data,
+	}, nil
+}
+
+func NewWebSocket(config *ActionConfig) *WebSocket {
+	return &WebSocket{
+		config: config,
+	}
+}
@@ -0,0 +1,114 @@
+package action
+
+import (
+	"context"
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"github.com/gorilla/websocket"
+	"github.com/troykinsella/crash/util"
+	"github.com/troykinsella/crash/logging"
+)
+
+func TestWebSocket(t *testing.T) {
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{"echo"},
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteMessage(websocket.TextMessage, []byte("hello " + r.Header.Get("X-User")))
+		for {
+			mt, b, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(b) == "bye" {
+				msg := websocket.FormatCloseMessage(4000, "done")
+				conn.WriteMessage(websocket.CloseMessage, msg)
+				return
+			}
+			conn.WriteMessage(mt, b)
+		}
+	}))
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	var tests = []struct {
+		params    map[string]interface{}
+		messages  []string
+		matched   bool
+		timedOut  bool
+		closeCode int
+	}{
+		{
+			map[string]interface{}{ "count": 1 },
+			[]string{"hello alice"}, false, false, 0,
+		},
+		{
+			map[string]interface{}{
+				"send": []interface{}{
+					"one",
+					map[interface{}]interface{}{ "json": map[string]interface{}{ "n": 2 } },
+					map[interface{}]interface{}{ "binary": "dGhyZWU=" },
+					"bye",
+				},
+			},
+			[]string{"hello alice", "one", `{"n":2}`, "three"}, false, false, 4000,
+		},
+		{
+			map[string]interface{}{ "send": []interface{}{"one", "two"}, "until": "one" },
+			[]string{"hello alice", "one"}, true, false, 0,
+		},
+		{
+			map[string]interface{}{ "read_timeout": "100ms" },
+			[]string{"hello alice"}, false, true, 0,
+		},
+	}
+
+	for i, test := range tests {
+		test.params["url"] = url
+		test.params["subprotocols"] = []interface{}{"echo"}
+		test.params["headers"] = map[string]interface{}{ "X-User": "alice" }
+		a := NewWebSocket(&ActionConfig{
+			Name: "websocket",
+			Params: util.AsValues(test.params),
+			Log: logging.NewLogger(logging.L_OFF, false, false),
+		})
+
+		r, err := a.Run(context.Background())
+		if err != nil {
+			t.Errorf("%d. unexpected error: %s\n", i, err.Error())
+			continue
+		}
+
+		messages := r.Data["messages"].([]interface{})
+		if len(messages) != len(test.messages) {
+			t.Errorf("%d. unexpected messages: %v\n", i, messages)
+			continue
+		}
+		for j, m := range test.messages {
+			if messages[j].(map[string]interface{})["data"] != m {
+				t.Errorf("%d. unexpected message %d:\nexpected=%s,\nactual=%v\n", i, j, m, messages[j])
+			}
+		}
+		if r.Data["subprotocol"] != "echo" {
+			t.Errorf("%d. unexpected subprotocol: %v\n", i, r.Data["subprotocol"])
+		}
+		if r.Data["matched"] != test.matched {
+			t.Errorf("%d. unexpected matched: %v\n", i, r.Data["matched"])
+		}
+		if r.Data["timed-out"] != test.timedOut {
+			t.Errorf("%d. unexpected timed-out: %v\n", i, r.Data["timed-out"])
+		}
+		if r.Data["close-code"] != test.closeCode {
+			t.Errorf("%d. unexpected close-code: %v\n", i, r.Data["close-code"])
+		}
+	}
+}
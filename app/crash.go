@@ -3,6 +3,7 @@ package app
 import (
 	"errors"
 	"github.com/troykinsella/crash/runtime"
+	"github.com/troykinsella/crash/action"
 	"github.com/troykinsella/crash"
 	"os"
 	"fmt"
@@ -51,6 +52,8 @@ func (*Crash) Test(options *crash.TestOptions) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	options.Crashfile = cf
+	action.Actions.SetPluginDirs(options.PluginDirs)
 
 	config := crash.NewConfig()
 	err = config.UnmarshalYAMLFile(cf)
@@ -71,11 +74,12 @@ func (*Crash) Test(options *crash.TestOptions) (bool, error) {
 	return ok, nil
 }
 
-func (*Crash) Validate(f string) error {
+func (*Crash) Validate(f string, pluginDirs []string) error {
 	cf, err:= findCrashFile(f)
 	if err != nil {
 		return err
 	}
+	action.Actions.SetPluginDirs(pluginDirs)
 
 	config := crash.NewConfig()
 	err = config.UnmarshalYAMLFile(cf)
@@ -20,6 +20,7 @@ const (
 	setVariable = "s"
 	testFile    = "f"
 	nocolor     = "nc"
+	pluginDir   = "p"
 )
 
 func loadVariablesFile(file string, vars map[string]string) error {
@@ -81,6 +82,7 @@ func newTestOptions(c *cli.Context) (*crash.TestOptions, error) {
 		Colorize: !c.IsSet(nocolor),
 		LogJson: c.Bool(json),
 		Variables: vars,
+		PluginDirs: c.StringSlice(pluginDir),
 	}
 	return options, nil
 }
@@ -126,6 +128,11 @@ func newTestCommand() *cli.Command {
 				Name: quiet,
 				Usage: "Quiet mode; suppress logging",
 			},
+			cli.StringSliceFlag{
+				Name:  pluginDir,
+				Usage: "Search `DIR` for action plugins before the PATH",
+				EnvVar: "CRASH_PLUGIN_DIRS",
+			},
 			cli.StringSliceFlag{
 				Name:  setVariable,
 				Usage: "Set variable(s) `FILE|KEY=VALUE`",
@@ -10,9 +10,11 @@ func newValidateCommand() *cli.Command {
 		Name:        "validate",
 		Aliases:     []string{"v"},
 		Usage:       "Validate a Crashfile test plan without running it",
+		Description: "Checks the Crashfile syntax, the step structure and check expressions,\n" +
+		"   and that each action has a known type and valid parameters.\n",
 		Action: func(c *cli.Context) error {
 			a := app.New()
-			err := a.Validate(c.String(testFile))
+			err := a.Validate(c.String(testFile), c.StringSlice(pluginDir))
 			if err != nil {
 				return cli.NewExitError(err.Error(), 1)
 			}
@@ -23,6 +25,11 @@ func newValidateCommand() *cli.Command {
 				Name:  testFile,
 				Usage: "Crashfile test plan yaml `FILE`",
 			},
+			cli.StringSliceFlag{
+				Name:  pluginDir,
+				Usage: "Search `DIR` for action plugins before the PATH",
+				EnvVar: "CRASH_PLUGIN_DIRS",
+			},
 		},
 	}
 }
@@ -66,12 +66,18 @@ type StepConfig struct {
 	Run      *ActionConfig `yaml:"run,omitempty"`
 	Serial   *StepConfigs  `yaml:"serial,omitempty"`
 	Parallel *StepConfigs  `yaml:"parallel,omitempty"`
+	Id       string        `yaml:"id,omitempty"`
+	Merge    string        `yaml:"merge,omitempty"`
+	When     string        `yaml:"when,omitempty"`
 	With     *WithConfig   `yaml:"with,omitempty"`
+	Until    *UntilConfig  `yaml:"until,omitempty"`
+	Retries  *RetryConfig  `yaml:"retries,omitempty"`
 
 	Success *StepConfigs `yaml:"success,omitempty"`
 	Failure *StepConfigs `yaml:"failure,omitempty"`
 	Always  *StepConfigs `yaml:"always,omitempty"`
 
+	Capture map[string]CaptureConfig `yaml:"capture,omitempty"`
 	Checks  []string     `yaml:"check,omitempty"`
 	Timeout string       `yaml:"timeout,omitempty"`
 }
@@ -81,7 +87,7 @@ type StepConfigs []StepConfig
 type ActionConfig struct {
 	Name   string            `yaml:"name"`
 	Type   string            `yaml:"type"`
-	Params map[string]string `yaml:"params"`
+	Params map[string]interface{} `yaml:"params"`
 }
 
 type WithConfig struct {
@@ -90,7 +96,8 @@ type WithConfig struct {
 	Map     map[string]string           `yaml:"map,omitempty"`
 	Range   *WithRangeConfig            `yaml:"range,omitempty"`
 
-	As      string                      `yaml:"as,omitempty"`
+	As       string                     `yaml:"as,omitempty"`
+	Parallel int                        `yaml:"parallel,omitempty"`
 }
 
 type WithRangeConfig struct {
@@ -98,3 +105,50 @@ type WithRangeConfig struct {
 	To      string     `yaml:"to"`
 	Step    string     `yaml:"step,omitempty"`
 }
+
+// Extracts a value into a variable. Given as a string, it is an expression.
+type CaptureConfig struct {
+	Expr    string     `yaml:"expr,omitempty"`
+	Regex   string     `yaml:"regex,omitempty"`
+	From    string     `yaml:"from,omitempty"`
+	Group   *int       `yaml:"group,omitempty"`
+	Header  string     `yaml:"header,omitempty"`
+}
+
+func (c *CaptureConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var expr string
+	if err := unmarshal(&expr); err == nil {
+		c.Expr = expr
+		return nil
+	}
+
+	type plain CaptureConfig
+	return unmarshal((*plain)(c))
+}
+
+// Re-runs a failed step. Given as an integer, it is the count of retries.
+type RetryConfig struct {
+	Count       int        `yaml:"count"`
+	Interval    string     `yaml:"interval,omitempty"`
+	MaxInterval string     `yaml:"max_interval,omitempty"`
+	Backoff     string     `yaml:"backoff,omitempty"`
+}
+
+func (c *RetryConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var count int
+	if err := unmarshal(&count); err == nil {
+		c.Count = count
+		return nil
+	}
+
+	type plain RetryConfig
+	return unmarshal((*plain)(c))
+}
+
+type UntilConfig struct {
+	Interval    string     `yaml:"interval,omitempty"`
+	MaxInterval string     `yaml:"max_interval,omitempty"`
+	Backoff     string     `yaml:"backoff,omitempty"`
+	Attempts    int        `yaml:"attempts,omitempty"`
+	Deadline    string     `yaml:"deadline,omitempty"`
+}
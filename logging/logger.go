@@ -21,6 +21,8 @@ const (
 	CHECK
 	INFO
 	DEBUG
+	SKIP
+	RETRY
 )
 
 const (
@@ -31,6 +33,19 @@ const (
 	L_DEBUG
 )
 
+// The number of steps of a plan that passed, failed, or were skipped.
+// Flaky steps failed, but passed when retried.
+type Counts struct {
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+	Flaky   int `json:"flaky"`
+}
+
+func (c *Counts) String() string {
+	return fmt.Sprintf("%d passed, %d failed, %d skipped, %d flaky", c.Passed, c.Failed, c.Skipped, c.Flaky)
+}
+
 type Logger struct {
 	level    Level
 	json     bool
@@ -57,6 +72,16 @@ func (l *Logger) Finish(t MessageType, ok bool, d time.Duration, msg string, dat
 	l.log(t, d, util.BoolFor(ok), nil, msg, data)
 }
 
+// Logs that a step was skipped.
+func (l *Logger) Skip(msg string) {
+	l.log(SKIP, -1, nil, nil, msg, nil)
+}
+
+// Logs an attempt of a retried step. The data describes the attempt.
+func (l *Logger) Retry(msg string, data interface{}) {
+	l.log(RETRY, -1, nil, nil, msg, data)
+}
+
 func (l *Logger) Error(t MessageType, d time.Duration, err error, msg string) {
 	l.log(t, d, util.False, err, msg, nil)
 }
@@ -99,6 +124,8 @@ func (l *Logger) levelForMessage(t MessageType, ok *util.Bool) Level {
 			return L_DETAIL
 		}
 		return L_DEFAULT
+	case SKIP, RETRY:
+		return L_DEFAULT
 	case SERIAL, PARALLEL, INFO:
 		return L_INFO
 	case DEBUG:
@@ -124,7 +151,7 @@ func (l *Logger) log(t MessageType,
 	if l.json {
 		l.logJSON(t, d, ok, err, msg, data)
 	} else {
-		l.logHuman(t, d, ok, err, msg)
+		l.logHuman(t, d, ok, err, msg, data)
 	}
 }
 
@@ -150,6 +177,10 @@ func (l *Logger) logJSON(t MessageType,
 		typeStr = "info"
 	case DEBUG:
 		typeStr = "debug"
+	case SKIP:
+		typeStr = "skip"
+	case RETRY:
+		typeStr = "retry"
 	}
 
 	m := map[string]interface{}{
@@ -160,12 +191,27 @@ func (l *Logger) logJSON(t MessageType,
 
 	if l.enabled(L_DEBUG) && t == ACTION {
 		m["result"] = data
+	} else if t == ACTION {
+		// Timing is useful at any level for latency analysis
+		if d, ok := data.(map[string]interface{}); ok && d["timing"] != nil {
+			m["result"] = map[string]interface{}{
+				"timing": d["timing"],
+			}
+		}
 	}
 
 	if t == CHECK && ok != nil {
 		m["pass"] = ok.Value()
 	}
 
+	if c, ok := data.(*Counts); ok && t == PLAN {
+		m["counts"] = c
+	}
+
+	if t == RETRY && data != nil {
+		m["retry"] = data
+	}
+
 	if err != nil {
 		m["error"] = err.Error()
 	}
@@ -182,7 +228,8 @@ func (l *Logger) logHuman(t MessageType,
 						  d time.Duration,
 						  ok *util.Bool,
 						  err error,
-						  msg string) {
+						  msg string,
+						  data interface{}) {
 	var typeStr string
 	switch t {
 	case ACTION:
@@ -210,6 +257,18 @@ func (l *Logger) logHuman(t MessageType,
 		typeStr = "I"
 	case DEBUG:
 		typeStr = "D"
+	case SKIP:
+		if l.colorize {
+			typeStr = "\033[33m~\033[0m"
+		} else {
+			typeStr = "~"
+		}
+	case RETRY:
+		if l.colorize {
+			typeStr = "\033[33mR\033[0m"
+		} else {
+			typeStr = "R"
+		}
 	}
 
 	okStr := "."
@@ -243,6 +302,10 @@ func (l *Logger) logHuman(t MessageType,
 		msg = fmt.Sprintf("%s: %s", msg, err.Error())
 	}
 
+	if c, ok := data.(*Counts); ok && t == PLAN {
+		msg = fmt.Sprintf("%s (%s)", msg, c.String())
+	}
+
 	fmt.Printf("%s %s%s%s %s\n", typeStr, okStr, nowStr, durStr, msg)
 }
 
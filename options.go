@@ -9,4 +9,5 @@ type TestOptions struct {
 	LogJson        bool
 	Variables      map[string]string
 	VariablesFiles []string
+	PluginDirs     []string
 }
@@ -0,0 +1,95 @@
+package runtime
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+type BackoffType uint8
+
+const (
+	// The same delay between each attempt
+	FIXED BackoffType = iota
+	// A delay doubling after each attempt
+	EXPONENTIAL
+	// An exponential delay, randomized between half and the whole of it
+	JITTER
+)
+
+const defaultBackoffInterval = time.Second
+
+// Backoff computes the delay before repeating an attempt.
+type Backoff struct {
+	Type        BackoffType
+	Interval    time.Duration
+	MaxInterval time.Duration
+}
+
+// Returns the delay to wait after the given attempt, counting from 1.
+func (b *Backoff) Delay(attempt int) time.Duration {
+	d := b.Interval
+	if b.Type != FIXED {
+		for i := 1; i < attempt && (b.MaxInterval <= 0 || d < b.MaxInterval); i++ {
+			d *= 2
+		}
+	}
+	if b.MaxInterval > 0 && d > b.MaxInterval {
+		d = b.MaxInterval
+	}
+	if b.Type == JITTER && d > 1 {
+		d = d/2 + time.Duration(rand.Int63n(int64(d/2)))
+	}
+	return d
+}
+
+func parseBackoffType(s string) (BackoffType, error) {
+	switch s {
+	case "", "fixed":
+		return FIXED, nil
+	case "exponential":
+		return EXPONENTIAL, nil
+	case "jitter":
+		return JITTER, nil
+	}
+	return FIXED, fmt.Errorf("invalid backoff; expected fixed, exponential, or jitter: %s", s)
+}
+
+// Returns a positive duration parsed from the given string, or the default
+// when it is empty.
+func parsePositiveDuration(name string, s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return -1, err
+	}
+	if d <= 0 {
+		return -1, fmt.Errorf("%s must be greater than zero: %s", name, s)
+	}
+	return d, nil
+}
+
+func newBackoff(backoff string, interval string, maxInterval string) (*Backoff, error) {
+	t, err := parseBackoffType(backoff)
+	if err != nil {
+		return nil, err
+	}
+
+	i, err := parsePositiveDuration("interval", interval, defaultBackoffInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	mi, err := parsePositiveDuration("max_interval", maxInterval, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Backoff{
+		Type: t,
+		Interval: i,
+		MaxInterval: mi,
+	}, nil
+}
@@ -0,0 +1,44 @@
+package runtime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	var tests = []struct {
+		backoff Backoff
+		delays  []time.Duration
+	}{
+		{
+			Backoff{FIXED, time.Second, -1},
+			[]time.Duration{time.Second, time.Second, time.Second},
+		},
+		{
+			Backoff{EXPONENTIAL, time.Second, -1},
+			[]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second},
+		},
+		{
+			Backoff{EXPONENTIAL, time.Second, 3 * time.Second},
+			[]time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second},
+		},
+	}
+
+	for i, test := range tests {
+		for j, expected := range test.delays {
+			d := test.backoff.Delay(j + 1)
+			if d != expected {
+				t.Errorf("%d. unexpected delay after attempt %d:\nexpected=%s,\nactual=%s\n", i, j + 1, expected, d)
+			}
+		}
+	}
+
+	b := Backoff{JITTER, time.Second, -1}
+	for attempt := 1; attempt <= 4; attempt++ {
+		max := time.Second << uint(attempt - 1)
+		d := b.Delay(attempt)
+		if d < max / 2 || d >= max {
+			t.Errorf("unexpected jitter delay after attempt %d: %s\n", attempt, d)
+		}
+	}
+}
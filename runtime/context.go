@@ -1,13 +1,26 @@
 package runtime
 
 import (
+	"context"
 	"github.com/troykinsella/crash"
 	"github.com/troykinsella/crash/logging"
+	"github.com/troykinsella/crash/action"
+	"path/filepath"
+	"sync"
+	"time"
 )
 
 type Context struct {
-	log     *logging.Logger
-	vars    Variables
+	log      *logging.Logger
+	vars     Variables
+	sessions *action.Sessions
+	dir      string
+
+	// Done when the enclosing step times out
+	done     context.Context
+
+	// Counts the steps of the running plan
+	counts   *stepCounts
 }
 
 func newTestContext(options *crash.TestOptions, config *crash.Config) (*Context, error) {
@@ -28,6 +41,10 @@ func newTestContext(options *crash.TestOptions, config *crash.Config) (*Context,
 	return &Context{
 		log: log,
 		vars: vars,
+		sessions: action.NewSessions(nil),
+		dir: filepath.Dir(options.Crashfile),
+		done: context.Background(),
+		counts: newStepCounts(),
 	}, nil
 }
 
@@ -35,9 +52,96 @@ func (ctx *Context) NewChild() *Context {
 	return &Context{
 		log: ctx.log,
 		vars: ctx.vars.NewChild(),
+		sessions: ctx.sessions,
+		dir: ctx.dir,
+		done: ctx.done,
+		counts: ctx.counts,
+	}
+}
+
+// Returns a copy of this context having a new scope of sessions.
+func (ctx *Context) NewSessionScope() *Context {
+	return &Context{
+		log: ctx.log,
+		vars: ctx.vars,
+		sessions: action.NewSessions(ctx.sessions),
+		dir: ctx.dir,
+		done: ctx.done,
+		counts: ctx.counts,
 	}
 }
 
+// Returns a copy of this context which is done after the given timeout
+// elapses, or when this context is done. A zero timeout never elapses.
+func (ctx *Context) WithTimeout(d time.Duration) (*Context, context.CancelFunc) {
+	c := *ctx
+	var cancel context.CancelFunc
+	if d > 0 {
+		c.done, cancel = context.WithTimeout(ctx.done, d)
+	} else {
+		c.done, cancel = context.WithCancel(ctx.done)
+	}
+	return &c, cancel
+}
+
+// Returns a copy of this context which counts steps separately.
+func (ctx *Context) WithCounts() *Context {
+	c := *ctx
+	c.counts = newStepCounts()
+	return &c
+}
+
 func (ctx *Context) Commit() {
 	ctx.vars = ctx.vars.Commit()
 }
+
+// Counts the results of steps. Steps running in parallel share the counts.
+type stepCounts struct {
+	mutex  sync.Mutex
+	counts logging.Counts
+}
+
+func newStepCounts() *stepCounts {
+	return &stepCounts{}
+}
+
+// Counts the result of an action step, and of any flaky step.
+func (c *stepCounts) count(action bool, result *StepResult) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if result.Flaky {
+		c.counts.Flaky++
+	}
+	if !action {
+		return
+	}
+	if result.Ok {
+		c.counts.Passed++
+	} else {
+		c.counts.Failed++
+	}
+}
+
+func (c *stepCounts) skip() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.counts.Skipped++
+}
+
+func (c *stepCounts) addAll(other *stepCounts) {
+	o := other.get()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.counts.Passed += o.Passed
+	c.counts.Failed += o.Failed
+	c.counts.Skipped += o.Skipped
+	c.counts.Flaky += o.Flaky
+}
+
+// Returns a copy of the counts.
+func (c *stepCounts) get() *logging.Counts {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	counts := c.counts
+	return &counts
+}
@@ -8,6 +8,12 @@ import (
 	"github.com/troykinsella/crash/logging"
 	"fmt"
 	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 	"github.com/troykinsella/crash/system/data"
 )
 
@@ -53,6 +59,9 @@ func (e *engine) Run(tp *TestPlan) (bool, error) {
 
 func (e *engine) runPlan(plan *PlanExec, ctx *Context) (bool, error) {
 
+	ctx = ctx.NewSessionScope().WithCounts()
+	defer ctx.sessions.Close()
+
 	ctx.log.Start(logging.PLAN, plan.plan.Name)
 
 	root := newRootStep(plan.plan.Steps)
@@ -62,7 +71,7 @@ func (e *engine) runPlan(plan *PlanExec, ctx *Context) (bool, error) {
 
 	root.Finish()
 
-	ctx.log.Finish(logging.PLAN, result.Ok, root.RunDuration(), plan.plan.Name, nil)
+	ctx.log.Finish(logging.PLAN, result.Ok, root.RunDuration(), plan.plan.Name, ctx.counts.get())
 
 	if result.Error != nil {
 		return false, result.Error
@@ -103,61 +112,321 @@ func (e *engine) iterateWithItem(s *system.Script, ctx *Context) (itr util.Itera
 	switch val := result.(type) {
 	case []interface{}:
 		itr, err = util.NewSliceIterator(val)
-	case map[interface{}]interface{}:
-		fmt.Printf("MAP\n")
-	case int64:
-		itr, err = util.NewRangeIterator(0, int(val), 1)
+	case map[string]interface{}, map[interface{}]interface{}:
+		itr, err = util.NewMapIterator(util.ToStringMap(val))
 	default:
-		n, err := data.ToInt(val)
-		if err == nil {
-			itr, err = util.NewRangeIterator(0, int(n), 1)
+		var n int64
+		n, err = data.ToInt(val)
+		if err != nil {
+			return nil, fmt.Errorf("cannot iterate with item: %v", val)
 		}
+		itr, err = iterateTimes(int(n))
 	}
 	return
 }
 
+// Iterates from 0 to n, exclusive.
+func iterateTimes(n int) (util.Iterator, error) {
+	if n <= 0 {
+		return util.NewSliceIterator([]interface{}{})
+	}
+	return util.NewRangeIterator(0, n - 1, 1)
+}
+
+func (e *engine) iterateWithMap(m map[string]*system.Script, ctx *Context) (util.Iterator, error) {
+	vals := make(map[string]interface{}, len(m))
+	for k, s := range m {
+		if s == nil {
+			vals[k] = ""
+			continue
+		}
+		_, val, _, err := e.interp.Run(s, ctx.vars)
+		if err != nil {
+			return nil, err
+		}
+		vals[k] = val
+	}
+
+	return util.NewMapIterator(vals)
+}
+
+func (e *engine) evalRangeBound(b *RangeBound, name string, ctx *Context) (int, error) {
+	if b.Script == nil {
+		return b.Value, nil
+	}
+	_, val, _, err := e.interp.Run(b.Script, ctx.vars)
+	if err == nil {
+		var n int64
+		n, err = data.ToInt(val)
+		if err == nil {
+			return int(n), nil
+		}
+	}
+	return 0, fmt.Errorf("with range %s: %s", name, err.Error())
+}
+
+func (e *engine) iterateWithRange(r *WithRange, ctx *Context) (util.Iterator, error) {
+	from, err := e.evalRangeBound(r.From, "from", ctx)
+	if err != nil {
+		return nil, err
+	}
+	to, err := e.evalRangeBound(r.To, "to", ctx)
+	if err != nil {
+		return nil, err
+	}
+	step, err := e.evalRangeBound(r.Step, "step", ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return util.NewRangeIterator(from, to, step)
+}
+
 func (e *engine) iterateWith(w *WithDirective, ctx *Context) (util.Iterator, error) {
 	switch {
 	case w.Item != nil:
 		return e.iterateWithItem(w.Item, ctx)
 	case w.List != nil:
 		return e.iterateWithList(w.List, ctx)
+	case w.Map != nil:
+		return e.iterateWithMap(w.Map, ctx)
+	case w.Range != nil:
+		return e.iterateWithRange(w.Range, ctx)
 	}
 	return nil, errors.New("internal error")
 }
 
+// Sets the variables describing the current iteration of a loop.
+func setLoopVars(vars Variables, w *WithDirective, val interface{}, index int, length int) {
+	as := w.As
+	if as == "" {
+		as = "i"
+	}
+
+	if entry, ok := val.(util.Entry); ok {
+		vars.Set("key", entry.Key)
+		vars.Set("value", entry.Value)
+		val = entry.Value
+	}
+	vars.Set(as, val)
+
+	vars.Set("index", index)
+	vars.Set("first", index == 0)
+	vars.Set("last", index == length - 1)
+	vars.Set("length", length)
+}
+
 func (e *engine) runStepLoop(se *StepExec, ctx *Context) (chan *StepResult) {
-	ch := make(chan *StepResult)
+	ch := make(chan *StepResult, 1)
 
 	itr, err := e.iterateWith(se.Step.With, ctx)
 	if err != nil {
-		panic(err)
+		mt, stepName := e.selectStep(se, ctx)
+		ctx.log.Error(mt, 0, err, stepName)
+		ch <- &StepResult{
+			Ok: false,
+			Reason: err.Error(),
+		}
+		return ch
+	}
+
+	if se.Step.With.Parallel > 1 {
+		go func() {
+			ch <- aggregateResults(e.runIterationsParallel(se, ctx, itr))
+		}()
+		return ch
 	}
 
 	go func() {
 		results := make([]*StepResult, 0)
+		length := itr.Len()
+
+		for index := 0; itr.HasNext() && ctx.done.Err() == nil; index++ {
+			results = append(results, e.runIteration(se, ctx, itr.Next(), index, length))
+		}
+
+		ch <- aggregateResults(results)
+	}()
+
+	return ch
+}
+
+// Runs the iterations of a loop through a pool of workers, no larger than
+// the parallel setting of the loop. Results are in order of iteration.
+func (e *engine) runIterationsParallel(se *StepExec, ctx *Context, itr util.Iterator) []*StepResult {
+	type iteration struct {
+		index int
+		val   interface{}
+	}
+
+	length := itr.Len()
+	results := make([]*StepResult, length)
+	iterations := make(chan iteration)
 
-		for itr.HasNext() {
-			val := itr.Next()
+	workers := se.Step.With.Parallel
+	if workers > length {
+		workers = length
+	}
 
-			idx := se.Step.With.As
-			if idx == "" {
-				idx = "i"
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for it := range iterations {
+				results[it.index] = e.runIteration(se, ctx, it.val, it.index, length)
 			}
+		}()
+	}
+
+	for index := 0; itr.HasNext() && ctx.done.Err() == nil; index++ {
+		iterations <- iteration{index, itr.Next()}
+	}
+	close(iterations)
+	wg.Wait()
+
+	// Iterations not started because the loop was aborted have no result
+	ran := make([]*StepResult, 0, length)
+	for _, r := range results {
+		if r != nil {
+			ran = append(ran, r)
+		}
+	}
+	return ran
+}
+
+// Runs one iteration of a loop in its own variable and session scope.
+func (e *engine) runIteration(se *StepExec, ctx *Context, val interface{}, index int, length int) *StepResult {
+	vCtx := ctx.NewChild().NewSessionScope()
+	defer vCtx.sessions.Close()
+	setLoopVars(vCtx.vars, se.Step.With, val, index, length)
+
+	vStep := NewStepExec(se.Step)
+	vStep.looped = true
+
+	return <- e.runStep(vStep, vCtx)
+}
 
-			vCtx := ctx.NewChild()
-			vCtx.vars.Set(idx, val)
+// Repeats the step until its checks pass, the attempts are exhausted,
+// or the deadline passes.
+func (e *engine) runStepPoll(se *StepExec, ctx *Context) (chan *StepResult) {
+	ch := make(chan *StepResult, 1)
+	u := se.Step.Until
 
-			vStep := NewStepExec(se.Step)
-			vStep.looped = true
+	go func() {
+		pCtx, cancel := ctx.WithTimeout(u.Deadline)
+		defer cancel()
+
+		var result *StepResult
+		var aCtx *Context
+		for attempt := 1; ; attempt++ {
+			pStep := NewStepExec(se.Step)
+			pStep.looped = se.looped
+			pStep.polled = true
+
+			// Only the steps nested in the last attempt are counted
+			aCtx = pCtx.WithCounts()
+			result = <- e.runStep(pStep, aCtx)
+			if result.Ok {
+				break
+			}
+			if u.Attempts > 0 && attempt >= u.Attempts {
+				ctx.log.Infof("until: giving up after %d attempts", attempt)
+				break
+			}
 
-			subCh := e.runStep(vStep, vCtx)
+			delay := u.Delay(attempt)
+			ctx.log.Infof("until: attempt %d failed; retrying in %s", attempt, delay)
 
-			r := <- subCh
-			results = append(results, r)
+			select {
+			case <-time.After(delay):
+			case <-pCtx.done.Done():
+			}
+			if pCtx.done.Err() != nil {
+				ctx.log.Infof("until: deadline exceeded after %d attempts", attempt)
+				break
+			}
 		}
 
-		ch <- aggregateResults(results)
+		// An attempt aborted at the deadline may not have counted its
+		// nested steps, yet the step fails
+		counts := newStepCounts()
+		counts.addAll(aCtx.counts)
+		if !result.Ok && se.Step.Run == nil && counts.get().Failed == 0 {
+			counts.count(true, result)
+		}
+
+		ctx.counts.addAll(counts)
+		result = e.runHooks(se, ctx, result)
+		ctx.counts.count(se.Step.Run != nil, result)
+		ch <- result
+	}()
+
+	return ch
+}
+
+// Re-runs the step while it fails, until its retries are exhausted.
+func (e *engine) runStepRetry(se *StepExec, ctx *Context) (chan *StepResult) {
+	ch := make(chan *StepResult, 1)
+	r := se.Step.Retry
+	_, stepName := e.selectStep(se, ctx)
+	max := r.Count + 1
+
+	go func() {
+		var result *StepResult
+		var aCtx *Context
+		attempt := 1
+		for ; ; attempt++ {
+			rStep := NewStepExec(se.Step)
+			rStep.looped = se.looped
+			rStep.retried = true
+			rStep.attempt = attempt
+
+			// Only the steps nested in the last attempt are counted
+			aCtx = ctx.WithCounts()
+			result = <- e.runStep(rStep, aCtx)
+			if result.Ok || attempt >= max || ctx.done.Err() != nil {
+				break
+			}
+
+			delay := r.Delay(attempt)
+			ctx.log.Retry(fmt.Sprintf("%s: attempt %d of %d failed; retrying in %s", stepName, attempt, max, delay), map[string]interface{}{
+				"step": stepName,
+				"attempt": attempt,
+				"max-attempts": max,
+				"delay": delay.String(),
+			})
+
+			select {
+			case <-time.After(delay):
+			case <-ctx.done.Done():
+			}
+			if ctx.done.Err() != nil {
+				break
+			}
+		}
+
+		ctx.counts.addAll(aCtx.counts)
+		result.Attempts = attempt
+		result.Flaky = result.Ok && attempt > 1
+		if result.Flaky {
+			ctx.log.Retry(fmt.Sprintf("%s: flaky; passed on attempt %d of %d", stepName, attempt, max), map[string]interface{}{
+				"step": stepName,
+				"attempt": attempt,
+				"max-attempts": max,
+				"flaky": true,
+			})
+		} else if !result.Ok && attempt > 1 {
+			ctx.log.Retry(fmt.Sprintf("%s: failed after %d attempts", stepName, attempt), map[string]interface{}{
+				"step": stepName,
+				"attempt": attempt,
+				"max-attempts": max,
+			})
+		}
+
+		result = e.runHooks(se, ctx, result)
+		ctx.counts.count(se.Step.Run != nil, result)
+		ch <- result
 	}()
 
 	return ch
@@ -168,13 +437,30 @@ func (e *engine) runStep(se *StepExec, ctx *Context) (chan *StepResult) {
 	if s.With != nil && !se.looped {
 		return e.runStepLoop(se, ctx)
 	}
+	if s.When != nil && !se.polled && !se.retried {
+		if ch, skip := e.skipStep(se, ctx); skip {
+			return ch
+		}
+	}
+	if s.Until != nil && !se.polled {
+		return e.runStepPoll(se, ctx)
+	}
+	if s.Retry != nil && !se.retried {
+		return e.runStepRetry(se, ctx)
+	}
 
-	ch := make(chan *StepResult)
+	ch := make(chan *StepResult, 1)
 
 	mt, stepName := e.selectStep(se, ctx)
+	if se.retried {
+		stepName = fmt.Sprintf("%s (attempt %d of %d)", stepName, se.attempt, se.Step.Retry.Count + 1)
+	}
 	var ch2 chan *StepResult
 
-	ctx = ctx.NewChild()
+	// Hooks run in the enclosing context, which isn't done when the step times out
+	hookCtx := ctx
+
+	ctx, cancel := ctx.NewChild().WithTimeout(se.Step.Timeout)
 	ctx.log.Start(mt, stepName)
 	se.Start()
 
@@ -188,88 +474,268 @@ func (e *engine) runStep(se *StepExec, ctx *Context) (chan *StepResult) {
 	}
 
 	go func() {
+		// Stop the action or sub-steps, should they still be running
+		defer cancel()
+
+		var result *StepResult
 		select {
-		case result := <-ch2:
+		case result = <-ch2:
 			se.Finish()
+
+			// Captures of a failed step would only hide why it failed
+			var err error
+			if result.Ok {
+				err = e.doCaptures(se, ctx)
+			}
+			if s.Id != "" {
+				publishStep(ctx.vars, s.Id)
+			}
 			ctx.Commit()
-			ctx.log.Finish(mt, result.Ok, se.RunDuration(), stepName, result.Data)
-			e.afterStep(se, ctx, result, ch)
 
-		case <-util.Timeout(se.Step.Timeout):
-		    ctx.log.Error(mt, se.Step.Timeout, fmt.Errorf("timed out"), stepName)
-			ch <- &StepResult{
+			if err != nil {
+				ctx.log.Error(mt, se.RunDuration(), err, stepName)
+				result = &StepResult{
+					Ok: false,
+					Data: result.Data,
+					Reason: err.Error(),
+				}
+			} else {
+				ctx.log.Finish(mt, result.Ok, se.RunDuration(), stepName, result.Data)
+				result = e.afterStep(se, ctx, result)
+			}
+
+		case <-ctx.done.Done():
+			ctx.log.Error(mt, se.Step.Timeout, fmt.Errorf("timed out"), stepName)
+			result = &StepResult{
 				Ok: false,
+				Reason: "timed out",
 			}
 		}
+
+		// The hooks of a polled or retried step run once it's complete
+		if !se.polled && !se.retried {
+			result = e.runHooks(se, hookCtx, result)
+			ctx.counts.count(se.Step.Run != nil, result)
+		}
+		ch <- result
 	}()
 
 	return ch
 }
 
+// Evaluates the when expression of the step, returning a channel having
+// the result of the step when it is skipped.
+func (e *engine) skipStep(se *StepExec, ctx *Context) (chan *StepResult, bool) {
+	mt, stepName := e.selectStep(se, ctx)
+
+	ok, _, msg, err := e.interp.Run(se.Step.When, ctx.vars)
+	if err == nil && ok {
+		return nil, false
+	}
+
+	ch := make(chan *StepResult, 1)
+	if err != nil {
+		ctx.log.Error(mt, 0, fmt.Errorf("when %s: %s", msg, err.Error()), stepName)
+		result := &StepResult{
+			Ok: false,
+			Error: err,
+			Reason: err.Error(),
+		}
+		ctx.counts.count(se.Step.Run != nil, result)
+		ch <- result
+		return ch, true
+	}
+
+	ctx.log.Skip(fmt.Sprintf("%s: when %s", stepName, msg))
+	ctx.counts.skip()
+
+	ch <- &StepResult{
+		Ok: true,
+		Skipped: true,
+	}
+	return ch, true
+}
+
+// Sets the variables captured from the outputs of the step.
+func (e *engine) doCaptures(se *StepExec, ctx *Context) error {
+	for _, c := range se.Step.Captures {
+		val, err := e.capture(c, ctx.vars)
+		if err != nil {
+			return fmt.Errorf("capture %s: %s", c.Name, err.Error())
+		}
+		ctx.vars.Set(c.Name, val)
+	}
+	return nil
+}
+
+func (e *engine) capture(c *Capture, vars Variables) (interface{}, error) {
+	if c.Header != "" {
+		return findHeader(vars.Get("headers"), c.Header)
+	}
+
+	_, val, _, err := e.interp.Run(c.Expr, vars)
+	if err != nil || c.Regex == nil {
+		return val, err
+	}
+
+	m := c.Regex.FindStringSubmatch(util.ToString(val))
+	if m == nil {
+		return nil, fmt.Errorf("no match for regex: %s", c.Regex.String())
+	}
+	return m[c.Group], nil
+}
+
+// Returns the first value of the named header, ignoring case.
+func findHeader(headers interface{}, name string) (interface{}, error) {
+	var h map[string]interface{}
+	switch v := headers.(type) {
+	case http.Header:
+		h = make(map[string]interface{}, len(v))
+		for k, vals := range v {
+			h[k] = vals
+		}
+	default:
+		h = util.ToStringMap(headers)
+	}
+
+	for k, val := range h {
+		if !strings.EqualFold(k, name) {
+			continue
+		}
+		switch vals := val.(type) {
+		case []string:
+			if len(vals) > 0 {
+				return vals[0], nil
+			}
+		case []interface{}:
+			if len(vals) > 0 {
+				return vals[0], nil
+			}
+		default:
+			return val, nil
+		}
+	}
+	return nil, fmt.Errorf("no header: %s", name)
+}
+
 func (e *engine) afterStep(se *StepExec,
                            ctx *Context,
-                           result *StepResult,
-                           ch chan *StepResult) {
+                           result *StepResult) *StepResult {
 	if se.Step.Checks != nil {
-		e.doChecks(se, ctx, result, ch)
-	} else {
-		ch <- result
+		return e.doChecks(se, ctx, result)
 	}
+	return result
 }
 
 func (e *engine) doChecks(se *StepExec,
                           ctx *Context,
-                          result *StepResult,
-                          ch chan *StepResult) {
+                          result *StepResult) *StepResult {
 	rok := true
+	reason := ""
 	for _, check := range *se.Step.Checks {
 		ok, _, msg, err := e.interp.Run(check, ctx.vars)
 		if err != nil {
-			ch <- &StepResult{
+			return &StepResult{
 				Ok: false,
 				Error: err,
+				Reason: err.Error(),
 			}
-			return
 		}
 
 		e.rootCtx.log.Check(ok, msg, ctx.vars.AsMap())
 
+		if !ok && reason == "" {
+			reason = "check failed: " + msg
+		}
 		rok = rok && ok
 	}
 
 	result.Ok = rok
-	ch <- result
+	result.Reason = reason
+	return result
+}
+
+// Runs the success or failure hooks of the step, according to its result,
+// followed by its always hooks. Hooks have access to the outputs of the
+// step, along with its result. The step fails when a hook fails.
+func (e *engine) runHooks(se *StepExec, ctx *Context, result *StepResult) *StepResult {
+	s := se.Step
+
+	hooks := make(Steps, 0)
+	if result.Ok && s.Success != nil {
+		hooks = append(hooks, *s.Success...)
+	}
+	if !result.Ok && s.Failure != nil {
+		hooks = append(hooks, *s.Failure...)
+	}
+	if s.Always != nil {
+		hooks = append(hooks, *s.Always...)
+	}
+	if len(hooks) == 0 {
+		return result
+	}
+
+	// Hooks aren't counted among the steps of the plan
+	hCtx := ctx.NewChild().WithCounts()
+	hCtx.vars.Set("ok", result.Ok)
+	hCtx.vars.Set("failure", result.Reason)
+
+	hr := <- e.runSerial(NewStepExec(&Step{Serial: &hooks}), hCtx)
+	if !hr.Ok && result.Ok {
+		result.Ok = false
+		result.Reason = "hook failed: " + hr.Reason
+	}
+	return result
 }
 
 func (e *engine) runAction(se *StepExec, ctx *Context) (chan *StepResult) {
-	ch := make(chan *StepResult)
+	ch := make(chan *StepResult, 1)
 
 	go func() {
 		s := se.Step.Run
 
-		params := util.AsStringValues(s.Params)
-		params = system.NewInterpolatedValues(params, ctx.vars)
-
-		a := action.NewAction(&action.ActionConfig{
-			Name:   s.Type,
-			Params: params,
-			Log: e.rootCtx.log,
-		})
+		params, err := system.InterpolateValues(util.AsValues(s.Params), ctx.vars)
+		var a action.Action
+		if err == nil {
+			a, err = action.NewAction(&action.ActionConfig{
+				Name:   s.Type,
+				Params: params,
+				Log: e.rootCtx.log,
+				Sessions: ctx.sessions,
+				Dir: ctx.dir,
+			})
+		}
+		if err != nil {
+			ch <- &StepResult{
+				Ok: false,
+				Error: err,
+				Reason: err.Error(),
+			}
+			return
+		}
 
-		result, err := a.Run()
+		result, err := a.Run(ctx.done)
 
 		success := err == nil
 		var data map[string]interface{}
 
-		if success {
+		// A failed action may still publish outputs, which checks
+		// can assert on
+		if result != nil {
 			data = result.Data
 			ctx.vars.SetAll(data)
 		}
 
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		}
+
 		ch <- &StepResult{
 			Ok: success,
 			Data: data,
 			Error: err,
+			Reason: reason,
 		}
 	}()
 
@@ -277,7 +743,7 @@ func (e *engine) runAction(se *StepExec, ctx *Context) (chan *StepResult) {
 }
 
 func (e *engine) runSerial(se *StepExec, ctx *Context) (chan *StepResult) {
-	ch := make(chan *StepResult)
+	ch := make(chan *StepResult, 1)
 
 	go func() {
 		s := se.Step.Serial
@@ -286,6 +752,11 @@ func (e *engine) runSerial(se *StepExec, ctx *Context) (chan *StepResult) {
 		results := make([]*StepResult, stepLen)
 
 		for i, config := range *s {
+			if ctx.done.Err() != nil {
+				// Timed out; don't start the remaining steps
+				results = results[:i]
+				break
+			}
 			subStep := NewStepExec(&config)
 			subCh := e.runStep(subStep, ctx)
 			results[i] = <- subCh
@@ -298,16 +769,19 @@ func (e *engine) runSerial(se *StepExec, ctx *Context) (chan *StepResult) {
 }
 
 func (e *engine) runParallel(se *StepExec, ctx *Context) (chan *StepResult) {
-	ch := make(chan *StepResult)
+	ch := make(chan *StepResult, 1)
 
 	go func() {
 		p := se.Step.Parallel
 
 		channels := make([]chan *StepResult, len(*p))
+		branches := make([]*Context, len(*p))
 
+		// Each step has its own scope, merged once all have completed
 		for i, config := range *p {
 			subStep := NewStepExec(&config)
-			channels[i] = e.runStep(subStep, ctx)
+			branches[i] = ctx.NewChild()
+			channels[i] = e.runStep(subStep, branches[i])
 		}
 
 		var results = make([]*StepResult, len(channels))
@@ -317,21 +791,126 @@ func (e *engine) runParallel(se *StepExec, ctx *Context) (chan *StepResult) {
 			results[i] = <- ch
 		}
 
-		ch <- aggregateResults(results)
+		result := aggregateResults(results)
+		if err := mergeBranches(ctx.vars, branches, se.Step.Merge); err != nil {
+			ctx.log.Error(logging.PARALLEL, 0, err, "parallel")
+			result = &StepResult{
+				Ok: false,
+				Reason: err.Error(),
+			}
+		}
+		ch <- result
 	}()
 
 	return ch
 }
 
+// The variable holding the outputs of steps, by id.
+const stepsVar = "steps"
+
+// Publishes the variables set by a step as the outputs of its id.
+func publishStep(vars Variables, id string) {
+	outputs := vars.Locals()
+	delete(outputs, stepsVar)
+
+	// Copied, since enclosing scopes may share the map
+	steps := make(map[string]interface{})
+	util.PutAllForMapStringInterface(steps, util.ToStringMap(vars.Get(stepsVar)))
+	steps[id] = outputs
+	vars.Set(stepsVar, steps)
+}
+
+// Merges the variables set by parallel steps into the given scope.
+func mergeBranches(vars Variables, branches []*Context, policy MergePolicy) error {
+	locals := make([]map[string]interface{}, len(branches))
+	for i, b := range branches {
+		locals[i] = b.vars.Locals()
+	}
+
+	// The outputs of steps are merged by id, rather than replaced
+	steps := make(map[string]interface{})
+	util.PutAllForMapStringInterface(steps, util.ToStringMap(vars.Get(stepsVar)))
+	published := make([]map[string]interface{}, len(locals))
+	for i, l := range locals {
+		published[i] = util.ToStringMap(l[stepsVar])
+		delete(l, stepsVar)
+	}
+
+	if policy == MERGE_ERROR {
+		conflicts := findConflicts(unpublished(locals, published, steps))
+		for _, name := range findConflicts(published) {
+			conflicts = append(conflicts, stepsVar + "." + name)
+		}
+		if len(conflicts) > 0 {
+			sort.Strings(conflicts)
+			return fmt.Errorf("parallel steps set conflicting values for: %s", strings.Join(conflicts, ", "))
+		}
+	}
+
+	for _, l := range locals {
+		vars.SetAll(l)
+	}
+	changed := false
+	for _, m := range published {
+		if m != nil {
+			util.PutAllForMapStringInterface(steps, m)
+			changed = true
+		}
+	}
+	if changed {
+		vars.Set(stepsVar, steps)
+	}
+	return nil
+}
+
+// Returns the variables of each branch, less the outputs of the steps it
+// published by id, which are kept apart under steps.<id>.
+func unpublished(locals []map[string]interface{}, published []map[string]interface{}, prior map[string]interface{}) []map[string]interface{} {
+	result := make([]map[string]interface{}, len(locals))
+	for i, l := range locals {
+		result[i] = make(map[string]interface{}, len(l))
+		util.PutAllForMapStringInterface(result[i], l)
+
+		for id, outputs := range published[i] {
+			if reflect.DeepEqual(prior[id], outputs) {
+				// Published before the branch ran
+				continue
+			}
+			for name, val := range util.ToStringMap(outputs) {
+				if reflect.DeepEqual(result[i][name], val) {
+					delete(result[i], name)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// Returns the names having different values among the given maps.
+func findConflicts(maps []map[string]interface{}) []string {
+	merged := make(map[string]interface{})
+	conflicts := make(map[string]interface{})
+	for _, m := range maps {
+		for k, v := range m {
+			if prev, ok := merged[k]; ok && !reflect.DeepEqual(prev, v) {
+				conflicts[k] = true
+			}
+			merged[k] = v
+		}
+	}
+	return util.KeysForMapStringInterface(conflicts)
+}
+
 func aggregateResults(results []*StepResult) *StepResult {
-	result := true
 	for _, r := range results {
 		if !r.Ok {
-			result = false
-			break
+			return &StepResult{
+				Ok: false,
+				Reason: r.Reason,
+			}
 		}
 	}
 	return &StepResult{
-		Ok: result,
+		Ok: true,
 	}
 }
@@ -0,0 +1,942 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"github.com/troykinsella/crash"
+	"github.com/troykinsella/crash/action"
+	"github.com/troykinsella/crash/logging"
+)
+
+func runCrashfile(t *testing.T, yaml string) (bool, *TestRunner) {
+	config := crash.NewConfig()
+	if err := config.UnmarshalYAML([]byte(yaml)); err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := NewTestRunner(&crash.TestOptions{
+		LogLevel: logging.L_OFF,
+	}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := tr.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ok, tr
+}
+
+// Runs the steps of the first plan, returning their aggregate result and
+// the context they ran in.
+func runSteps(t *testing.T, yaml string) (*StepResult, *Context) {
+	return runStepsLogging(t, yaml, logging.L_OFF)
+}
+
+// Runs the steps of the first plan, logging at the given level.
+func runStepsLogging(t *testing.T, yaml string, level logging.Level) (*StepResult, *Context) {
+	config := crash.NewConfig()
+	if err := config.UnmarshalYAML([]byte(yaml)); err != nil {
+		t.Fatal(err)
+	}
+
+	tp, err := CompileTestPlan(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := NewTestRunner(&crash.TestOptions{
+		LogLevel: level,
+	}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := tr.createEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := tr.context.NewSessionScope().WithCounts()
+	defer ctx.sessions.Close()
+
+	result := <- e.runStep(newRootStep((*tp.Plans)[0].Steps), ctx)
+	return result, ctx
+}
+
+func TestParallelMerge(t *testing.T) {
+	var tests = []struct {
+		merge string
+		ok    bool
+	}{
+		{"", true},
+		{"ordered", true},
+		{"error", false},
+	}
+
+	for i, test := range tests {
+		ok, tr := runCrashfile(t, `
+plans:
+- plan: p
+  steps:
+  - parallel:
+    - run:
+        name: a
+        type: shell
+        params:
+          command: echo a
+      check:
+      - out eq 'a'
+    - run:
+        name: b
+        type: shell
+        params:
+          command: echo b
+      check:
+      - out eq 'b'
+    merge: `+test.merge+`
+`)
+		if ok != test.ok {
+			t.Errorf("%d. unexpected result:\nexpected=%t,\nactual=%t\n", i, test.ok, ok)
+		}
+
+		// The last listed step wins, or nothing is merged on conflict
+		expected := "b"
+		if !test.ok {
+			expected = ""
+		}
+		out := tr.context.vars.GetString("out")
+		if out != expected {
+			t.Errorf("%d. unexpected merged output:\nexpected=%q,\nactual=%q\n", i, expected, out)
+		}
+	}
+}
+
+func TestParallelMergeById(t *testing.T) {
+	var tests = []struct {
+		branches string
+		ok       bool
+	}{
+		// Outputs of steps having an id are read through steps.<id>
+		{"[{run: {name: a, type: shell, params: {command: echo a}}, id: a}, {run: {name: b, type: shell, params: {command: echo b}}, id: b}]", true},
+		{"[{run: {name: a, type: shell, params: {command: echo a}}, id: a}, {run: {name: b, type: shell, params: {command: echo b}}}]", true},
+
+		// Outputs of later steps without an id still conflict
+		{"[{serial: [{run: {name: a, type: shell, params: {command: echo a}}, id: a}, {run: {name: c, type: shell, params: {command: echo c}}}]}, {serial: [{run: {name: b, type: shell, params: {command: echo b}}, id: b}, {run: {name: e, type: shell, params: {command: echo e}}}]}]", false},
+	}
+
+	for i, test := range tests {
+		ok, tr := runCrashfile(t, `
+plans:
+- plan: p
+  steps:
+  - run: {name: x, type: shell, params: {command: echo x}}
+    id: x
+  - parallel: ` + test.branches + `
+    merge: error
+  - run: {name: d, type: shell, params: {command: echo d}}
+    check:
+    - steps.x.out eq 'x'
+    - steps.a.out eq 'a'
+`)
+		if ok != test.ok {
+			t.Errorf("%d. unexpected result:\nexpected=%t,\nactual=%t\n", i, test.ok, ok)
+			continue
+		}
+		if ok {
+			steps := tr.context.vars.Get("steps").(map[string]interface{})
+			for _, id := range []string{"a", "x"} {
+				if outputs, _ := steps[id].(map[string]interface{}); outputs["out"] != id {
+					t.Errorf("%d. unexpected outputs of step %s: %v\n", i, id, steps[id])
+				}
+			}
+		}
+	}
+}
+
+func TestParallelRace(t *testing.T) {
+	ok, _ := runCrashfile(t, `
+plans:
+- plan: p
+  steps:
+  - parallel:
+    - run:
+        name: a
+        type: shell
+        params:
+          command: echo $i
+      with: { range: { from: 1, to: 10 }, parallel: 5 }
+      check:
+      - out eq i
+    - serial:
+      - run:
+          name: b
+          type: shell
+          params:
+            command: echo b
+      - parallel:
+        - run:
+            name: c
+            type: shell
+            params:
+              command: echo $out
+          check:
+          - out eq 'b'
+        - run:
+            name: d
+            type: shell
+            params:
+              command: echo $out
+          check:
+          - out eq 'b'
+`)
+	if !ok {
+		t.Errorf("expected parallel steps to pass\n")
+	}
+}
+
+func TestStepOutputsById(t *testing.T) {
+	ok, tr := runCrashfile(t, `
+plans:
+- plan: p
+  steps:
+  - run:
+      name: a
+      type: shell
+      params:
+        command: echo a
+    id: a
+  - parallel:
+    - run:
+        name: b
+        type: shell
+        params:
+          command: echo b
+      id: b
+    - run:
+        name: c
+        type: shell
+        params:
+          command: echo c
+      id: c
+    merge: ordered
+  - run:
+      name: d
+      type: shell
+      params:
+        command: echo d
+    check:
+    - steps.a.out eq 'a'
+    - steps.b.out eq 'b'
+    - steps.c.out eq 'c'
+    - out eq 'd'
+`)
+	if !ok {
+		t.Errorf("expected checks of step outputs by id to pass\n")
+	}
+
+	steps := tr.context.vars.Get("steps").(map[string]interface{})
+	for _, id := range []string{"a", "b", "c"} {
+		outputs, _ := steps[id].(map[string]interface{})
+		if outputs["out"] != id {
+			t.Errorf("unexpected outputs of step %s: %v\n", id, steps[id])
+		}
+	}
+	if _, ok := steps["d"]; ok {
+		t.Errorf("unexpected outputs of step without id\n")
+	}
+}
+
+func TestStepIdDigits(t *testing.T) {
+	ok, _ := runCrashfile(t, `
+plans:
+- plan: p
+  steps:
+  - run: {name: a, type: shell, params: {command: echo a}}
+    id: step1
+  - run: {name: b, type: shell, params: {command: 'echo ${steps.step1.out}b'}}
+    id: step-2b
+    check:
+    - steps.step1.out eq 'a'
+    - steps.step-2b.out eq 'ab'
+`)
+	if !ok {
+		t.Errorf("expected step ids having digits to be referenced\n")
+	}
+}
+
+func TestCapture(t *testing.T) {
+	ok, tr := runCrashfile(t, `
+plans:
+- plan: p
+  steps:
+  - run:
+      name: a
+      type: shell
+      params:
+        command: echo id=42
+    id: a
+    capture:
+      line: out
+      id: { regex: 'id=(\d+)', from: out }
+    check:
+    - id eq '42'
+  - run:
+      name: b
+      type: shell
+      params:
+        command: echo $id
+    check:
+    - out eq '42'
+    - steps.a.id eq '42'
+`)
+	if !ok {
+		t.Errorf("expected checks of captured values to pass\n")
+	}
+	if line := tr.context.vars.GetString("line"); line != "id=42" {
+		t.Errorf("unexpected captured line: %q\n", line)
+	}
+}
+
+func TestFindHeader(t *testing.T) {
+	headers := http.Header{}
+	headers.Add("Content-Type", "text/plain")
+	headers.Add("Set-Cookie", "a=1")
+	headers.Add("Set-Cookie", "b=2")
+
+	var tests = []struct {
+		headers  interface{}
+		name     string
+		expected interface{}
+	}{
+		{headers, "content-type", "text/plain"},
+		{headers, "Set-Cookie", "a=1"},
+		{map[string]interface{}{"location": "/a"}, "Location", "/a"},
+		{map[string]interface{}{"x": []interface{}{"1", "2"}}, "X", "1"},
+		{headers, "Location", nil},
+		{nil, "Location", nil},
+	}
+
+	for i, test := range tests {
+		val, err := findHeader(test.headers, test.name)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("%d. expected error, found: %v\n", i, val)
+			}
+			continue
+		}
+		if err != nil || val != test.expected {
+			t.Errorf("%d. unexpected header:\nexpected=%v,\nactual=%v (%v)\n", i, test.expected, val, err)
+		}
+	}
+}
+
+// Writes a script that fails until it has run as many times as its
+// argument, printing the number of times it ran. Returns the script and
+// the file recording its runs.
+func flakyScript(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "flaky.sh")
+	runs := filepath.Join(dir, "runs")
+	err := ioutil.WriteFile(script, []byte("#!/bin/sh\necho x >> " + runs + "\nn=$(wc -l < " + runs + ")\necho $n\n[ $n -ge $1 ]\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return script, runs
+}
+
+func TestRetries(t *testing.T) {
+	script, runs := flakyScript(t)
+
+	var tests = []struct {
+		passOn   int
+		retries  int
+		ok       bool
+		attempts int
+	}{
+		{1, 2, true, 1},
+		{3, 2, true, 3},
+		{4, 2, false, 3},
+	}
+
+	for i, test := range tests {
+		os.Remove(runs)
+
+		ok, _ := runCrashfile(t, fmt.Sprintf(`
+plans:
+- plan: p
+  steps:
+  - serial:
+    - run:
+        name: flaky
+        type: shell
+        params:
+          command: %s %d
+    retries: { count: %d, interval: 1ms }
+`, script, test.passOn, test.retries))
+		if ok != test.ok {
+			t.Errorf("%d. unexpected result:\nexpected=%t,\nactual=%t\n", i, test.ok, ok)
+		}
+
+		b, _ := ioutil.ReadFile(runs)
+		if n := strings.Count(string(b), "\n"); n != test.attempts {
+			t.Errorf("%d. unexpected attempts:\nexpected=%d,\nactual=%d\n", i, test.attempts, n)
+		}
+	}
+}
+
+func TestStepCounts(t *testing.T) {
+	c := newStepCounts()
+	c.count(true, &StepResult{Ok: true})
+	c.count(true, &StepResult{Ok: false})
+	c.count(false, &StepResult{Ok: true, Flaky: true})
+	c.skip()
+
+	other := newStepCounts()
+	other.count(true, &StepResult{Ok: true, Flaky: true})
+	c.addAll(other)
+
+	expected := logging.Counts{Passed: 2, Failed: 1, Skipped: 1, Flaky: 2}
+	if *c.get() != expected {
+		t.Errorf("unexpected counts:\nexpected=%+v,\nactual=%+v\n", expected, *c.get())
+	}
+}
+
+func TestCaptureAfterFailure(t *testing.T) {
+	result, ctx := runSteps(t, `
+plans:
+- plan: p
+  steps:
+  - run:
+      name: a
+      type: shell
+      params:
+        command: exit 3
+    capture:
+      token: json.token
+`)
+	if result.Ok {
+		t.Errorf("expected the failed action to fail the step\n")
+	}
+	expected := "command exited with status 3"
+	if result.Reason != expected {
+		t.Errorf("unexpected reason:\nexpected=%q,\nactual=%q\n", expected, result.Reason)
+	}
+	if token := ctx.vars.Get("token"); token != nil {
+		t.Errorf("unexpected capture of a failed action: %v\n", token)
+	}
+}
+
+// An action counting how many of its kind run at once.
+type concurrencyAction struct {
+	tracker *concurrencyTracker
+}
+
+type concurrencyTracker struct {
+	mutex  sync.Mutex
+	runs   int
+	active int
+	max    int
+}
+
+func (a *concurrencyAction) Run(ctx context.Context) (*action.Result, error) {
+	tr := a.tracker
+	tr.mutex.Lock()
+	tr.runs++
+	tr.active++
+	if tr.active > tr.max {
+		tr.max = tr.active
+	}
+	tr.mutex.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	tr.mutex.Lock()
+	tr.active--
+	tr.mutex.Unlock()
+
+	return &action.Result{
+		Data: map[string]interface{}{},
+	}, nil
+}
+
+func TestWithParallel(t *testing.T) {
+	var tests = []struct {
+		item     int
+		parallel int
+		runs     int
+		max      int
+	}{
+		{0, 0, 0, 0},
+		{2, 0, 2, 1},
+		{10, 1, 10, 1},
+		{20, 4, 20, 4},
+		{3, 8, 3, 3},
+	}
+
+	for i, test := range tests {
+		tracker := &concurrencyTracker{}
+		action.Register("test-concurrency", func(config *action.ActionConfig) action.Action {
+			return &concurrencyAction{tracker}
+		})
+
+		ok, _ := runCrashfile(t, fmt.Sprintf(`
+plans:
+- plan: p
+  steps:
+  - run:
+      name: a
+      type: test-concurrency
+    with: { item: %d, parallel: %d }
+`, test.item, test.parallel))
+		if !ok {
+			t.Errorf("%d. expected loop to pass\n", i)
+		}
+		if tracker.runs != test.runs {
+			t.Errorf("%d. unexpected iterations:\nexpected=%d,\nactual=%d\n", i, test.runs, tracker.runs)
+		}
+		if tracker.max > test.max {
+			t.Errorf("%d. too many concurrent iterations:\nexpected at most %d,\nactual=%d\n", i, test.max, tracker.max)
+		}
+		if test.max > 1 && tracker.max < 2 {
+			t.Errorf("%d. expected iterations to run concurrently\n", i)
+		}
+	}
+}
+
+// An action recording the values of the given params, joined by "|".
+type recordAction struct {
+	config  *action.ActionConfig
+	keys    []string
+	records *[]string
+}
+
+func (a *recordAction) Run(ctx context.Context) (*action.Result, error) {
+	vals := make([]string, len(a.keys))
+	for i, k := range a.keys {
+		vals[i] = a.config.Params.GetString(k)
+	}
+	*a.records = append(*a.records, strings.Join(vals, "|"))
+	return &action.Result{
+		Data: map[string]interface{}{},
+	}, nil
+}
+
+// Registers the test-record action, returning the records it makes.
+func registerRecordAction(keys ...string) *[]string {
+	records := make([]string, 0)
+	action.Register("test-record", func(config *action.ActionConfig) action.Action {
+		return &recordAction{config, keys, &records}
+	})
+	return &records
+}
+
+func TestHooks(t *testing.T) {
+	var tests = []struct {
+		step    string
+		ok      bool
+		reason  string
+		records []string
+		passed  int
+		failed  int
+	}{
+		{
+			"{run: {name: a, type: shell, params: {command: 'exit 0'}}",
+			true, "",
+			[]string{"success|true|", "always|true|"},
+			1, 0,
+		},
+		{
+			"{run: {name: a, type: shell, params: {command: 'exit 3'}}",
+			false, "command exited with status 3",
+			[]string{"failure|false|command exited with status 3", "always|false|command exited with status 3"},
+			0, 1,
+		},
+		{
+			"{run: {name: a, type: shell, params: {command: 'echo a'}}, check: [\"out eq 'b'\"]",
+			false, "check failed: out eq 'b'",
+			[]string{"failure|false|check failed: out eq 'b'", "always|false|check failed: out eq 'b'"},
+			0, 1,
+		},
+		{
+			"{run: {name: a, type: shell, params: {command: 'sleep 2'}}, timeout: 50ms",
+			false, "timed out",
+			[]string{"failure|false|timed out", "always|false|timed out"},
+			0, 1,
+		},
+		{
+			"{run: {name: a, type: shell, params: {command: 'exit 0'}}, always: [{run: {name: h, type: shell, params: {command: 'exit 1'}}}]",
+			false, "hook failed: command exited with status 1",
+			[]string{"success|true|"},
+			0, 1,
+		},
+	}
+
+	for i, test := range tests {
+		records := registerRecordAction("hook", "ok", "failure")
+
+		hook := func(name string) string {
+			return "[{run: {name: " + name + ", type: test-record, params: {hook: " + name + ", ok: $ok, failure: $failure}}}]"
+		}
+		step := test.step
+		if !strings.Contains(step, "always:") {
+			step += ", always: " + hook("always")
+		}
+		step += ", success: " + hook("success") + ", failure: " + hook("failure") + "}"
+
+		result, ctx := runSteps(t, "plans: [{plan: p, steps: [" + step + "]}]")
+		if result.Ok != test.ok || result.Reason != test.reason {
+			t.Errorf("%d. unexpected result:\nexpected=%t %q,\nactual=%t %q\n", i, test.ok, test.reason, result.Ok, result.Reason)
+		}
+		if !reflect.DeepEqual(*records, test.records) {
+			t.Errorf("%d. unexpected hooks:\nexpected=%q,\nactual=%q\n", i, test.records, *records)
+		}
+
+		// Hooks aren't counted
+		counts := ctx.counts.get()
+		if counts.Passed != test.passed || counts.Failed != test.failed {
+			t.Errorf("%d. unexpected counts:\nexpected=%d passed, %d failed,\nactual=%+v\n", i, test.passed, test.failed, counts)
+		}
+	}
+}
+
+func TestUntil(t *testing.T) {
+	script, runs := flakyScript(t)
+
+	var tests = []struct {
+		passOn   int
+		until    string
+		ok       bool
+		attempts int
+		passed   int
+		failed   int
+	}{
+		{1, "{attempts: 3, interval: 1ms}", true, 1, 1, 0},
+		{3, "{attempts: 5, interval: 1ms}", true, 3, 1, 0},
+		{5, "{attempts: 2, interval: 1ms}", false, 2, 0, 1},
+		{1000, "{deadline: 200ms, interval: 20ms}", false, -1, 0, 1},
+	}
+
+	for i, test := range tests {
+		os.Remove(runs)
+
+		start := time.Now()
+		result, ctx := runSteps(t, fmt.Sprintf(`
+plans:
+- plan: p
+  steps:
+  - serial:
+    - run:
+        name: poll
+        type: shell
+        params:
+          command: %s %d
+    check:
+    - exit-code eq 0
+    until: %s
+`, script, test.passOn, test.until))
+		if result.Ok != test.ok {
+			t.Errorf("%d. unexpected result:\nexpected=%t,\nactual=%t\n", i, test.ok, result.Ok)
+		}
+
+		b, _ := ioutil.ReadFile(runs)
+		n := strings.Count(string(b), "\n")
+		if test.attempts >= 0 && n != test.attempts {
+			t.Errorf("%d. unexpected attempts:\nexpected=%d,\nactual=%d\n", i, test.attempts, n)
+		}
+		if test.attempts < 0 && (n < 2 || time.Since(start) > time.Second) {
+			t.Errorf("%d. expected polling to stop at the deadline: %d attempts in %s\n", i, n, time.Since(start))
+		}
+
+		// Only the last attempt is counted
+		counts := ctx.counts.get()
+		if counts.Passed != test.passed || counts.Failed != test.failed {
+			t.Errorf("%d. unexpected counts:\nexpected=%d passed, %d failed,\nactual=%+v\n", i, test.passed, test.failed, counts)
+		}
+	}
+
+	// An attempt aborted at the deadline is counted as failed
+	result, ctx := runSteps(t, `
+plans:
+- plan: p
+  steps:
+  - serial:
+    - run: {name: slow, type: shell, params: {command: sleep 5}}
+    check:
+    - exit-code eq 0
+    until: {deadline: 50ms}
+`)
+	if result.Ok {
+		t.Errorf("expected polling to fail at the deadline\n")
+	}
+	if counts := ctx.counts.get(); counts.Passed != 0 || counts.Failed != 1 {
+		t.Errorf("unexpected counts:\nexpected=0 passed, 1 failed,\nactual=%+v\n", counts)
+	}
+}
+
+func TestLoopVars(t *testing.T) {
+	var tests = []struct {
+		with    string
+		params  string
+		keys    []string
+		records []string
+	}{
+		{
+			"{map: {b: 2, a: 1}}",
+			"{i: $i, key: $key, value: $value, index: $index, first: $first, last: $last, length: $length}",
+			[]string{"i", "key", "value", "index", "first", "last", "length"},
+			[]string{"1|a|1|0|true|false|2", "2|b|2|1|false|true|2"},
+		},
+		{
+			"{list: [10, 20, 30], as: v}",
+			"{v: $v, index: $index, first: $first, last: $last, length: $length}",
+			[]string{"v", "index", "first", "last", "length"},
+			[]string{"10|0|true|false|3", "20|1|false|false|3", "30|2|false|true|3"},
+		},
+		{
+			"{range: {from: 6, to: 2, step: -2}}",
+			"{i: $i, index: $index, last: $last}",
+			[]string{"i", "index", "last"},
+			[]string{"6|0|false", "4|1|false", "2|2|true"},
+		},
+		{
+			"{item: 2}",
+			"{i: $i, length: $length}",
+			[]string{"i", "length"},
+			[]string{"0|2", "1|2"},
+		},
+	}
+
+	for i, test := range tests {
+		records := registerRecordAction(test.keys...)
+
+		// Integer values of lists and maps compare with literals
+		ok, _ := runCrashfile(t, `
+plans:
+- plan: p
+  steps:
+  - run:
+      name: a
+      type: test-record
+      params: ` + test.params + `
+    with: ` + test.with + `
+    when: index lt 5
+    check:
+    - index lt length
+    - length gte 1
+`)
+		if !ok {
+			t.Errorf("%d. expected loop to pass\n", i)
+		}
+		if !reflect.DeepEqual(*records, test.records) {
+			t.Errorf("%d. unexpected loop variables:\nexpected=%q,\nactual=%q\n", i, test.records, *records)
+		}
+	}
+
+	// Values bound as int64 compare with int literals
+	records := registerRecordAction("value")
+	ok, _ := runCrashfile(t, `
+plans:
+- plan: p
+  steps:
+  - run:
+      name: a
+      type: test-record
+      params: {value: $value}
+    with: {map: {a: 1, b: 2, c: 3}}
+    when: value gt 1
+    check:
+    - value gte 2
+    - value lte 3
+`)
+	if !ok {
+		t.Errorf("expected int64 values to compare\n")
+	}
+	if expected := []string{"2", "3"}; !reflect.DeepEqual(*records, expected) {
+		t.Errorf("unexpected values:\nexpected=%q,\nactual=%q\n", expected, *records)
+	}
+}
+
+func TestWhen(t *testing.T) {
+	var tests = []struct {
+		when    string
+		records []string
+		passed  int
+		skipped int
+	}{
+		{"x eq 1", []string{"a"}, 2, 0},
+		{"x eq 2", []string{}, 1, 1},
+	}
+
+	for i, test := range tests {
+		records := registerRecordAction("name")
+
+		result, ctx := runSteps(t, `
+plans:
+- plan: p
+  steps:
+  - run: {name: x, type: test-record, params: {name: x}}
+    capture: {x: 1}
+  - run: {name: a, type: test-record, params: {name: a}}
+    when: ` + test.when)
+		if !result.Ok {
+			t.Errorf("%d. expected steps to pass: %s\n", i, result.Reason)
+		}
+		if actual := (*records)[1:]; !reflect.DeepEqual(actual, test.records) {
+			t.Errorf("%d. unexpected actions run:\nexpected=%q,\nactual=%q\n", i, test.records, actual)
+		}
+
+		counts := ctx.counts.get()
+		if counts.Passed != test.passed || counts.Skipped != test.skipped || counts.Failed != 0 {
+			t.Errorf("%d. unexpected counts:\nexpected=%d passed, %d skipped,\nactual=%+v\n", i, test.passed, test.skipped, counts)
+		}
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	records := registerRecordAction("name")
+
+	// The timeout of the enclosing step ends the wait between attempts
+	start := time.Now()
+	result, _ := runSteps(t, `
+plans:
+- plan: p
+  steps:
+  - serial:
+    - run: {name: r, type: test-record, params: {name: r}}
+      check: [1 eq 2]
+      retries: {count: 3, interval: 10s}
+    timeout: 50ms
+`)
+	if result.Ok || time.Since(start) > time.Second {
+		t.Errorf("expected the step to time out: ok=%t after %s\n", result.Ok, time.Since(start))
+	}
+
+	// No attempt follows the timeout
+	time.Sleep(100 * time.Millisecond)
+	if expected := []string{"r"}; !reflect.DeepEqual(*records, expected) {
+		t.Errorf("unexpected attempts:\nexpected=%q,\nactual=%q\n", expected, *records)
+	}
+}
+
+func TestInterpolationFailure(t *testing.T) {
+	records := registerRecordAction("name")
+
+	result, ctx := runSteps(t, `
+plans:
+- plan: p
+  steps:
+  - run: {name: a, type: test-record, params: {name: $missing}}
+  - run: {name: b, type: test-record, params: {name: b}}
+`)
+	if result.Ok || result.Reason != "Not found: missing" {
+		t.Errorf("unexpected result:\nexpected=false %q,\nactual=%t %q\n", "Not found: missing", result.Ok, result.Reason)
+	}
+	if expected := []string{"b"}; !reflect.DeepEqual(*records, expected) {
+		t.Errorf("unexpected actions run:\nexpected=%q,\nactual=%q\n", expected, *records)
+	}
+	if counts := ctx.counts.get(); counts.Passed != 1 || counts.Failed != 1 {
+		t.Errorf("unexpected counts: %+v\n", counts)
+	}
+}
+
+func TestLoopSessions(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "user", Value: r.URL.Query().Get("user")})
+			return
+		}
+		if c, err := r.Cookie("user"); err == nil {
+			w.Write([]byte(c.Value))
+		} else {
+			w.Write([]byte("nobody"))
+		}
+	}))
+	defer ts.Close()
+
+	for i, with := range []string{
+		"{list: [\"'alice'\", \"'bob'\", \"'carol'\"], as: user}",
+		"{list: [\"'alice'\", \"'bob'\", \"'carol'\"], as: user, parallel: 3}",
+	} {
+		// Each iteration logs in to its own session, while sharing the
+		// session of the enclosing scope
+		ok, _ := runCrashfile(t, fmt.Sprintf(`
+plans:
+- plan: p
+  steps:
+  - run: {name: outer, type: http, params: {url: '%[1]s/login?user=dave', session: outer}}
+  - serial:
+    - run: {name: before, type: http, params: {url: '%[1]s/whoami', session: s}}
+      check: [body eq 'nobody']
+    - run: {name: login, type: http, params: {url: '%[1]s/login?user=${user}', session: s}}
+    - run: {name: after, type: http, params: {url: '%[1]s/whoami', session: s}}
+      check: [body eq user]
+    - run: {name: shared, type: http, params: {url: '%[1]s/whoami', session: outer}}
+      check: [body eq 'dave']
+    with: %[2]s
+`, ts.URL, with))
+		if !ok {
+			t.Errorf("%d. expected loop iterations to have their own sessions\n", i)
+		}
+	}
+}
+
+// Returns what the function writes to stdout.
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	out := make(chan string)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		out <- string(b)
+	}()
+
+	f()
+	w.Close()
+	return <-out
+}
+
+func TestRetryLog(t *testing.T) {
+	out := captureStdout(t, func() {
+		runStepsLogging(t, `
+plans:
+- plan: p
+  steps:
+  - run: {name: r, type: shell, params: {command: sleep 5}}
+    timeout: 50ms
+    retries: {count: 1, interval: 1ms}
+`, logging.L_DETAIL)
+	})
+
+	// Each attempt starts and times out under its own name
+	for _, attempt := range []string{"r (attempt 1 of 2)", "r (attempt 2 of 2)"} {
+		lines := make([]string, 0)
+		for _, line := range strings.Split(out, "\n") {
+			if strings.HasSuffix(line, attempt) || strings.Contains(line, attempt + ":") {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) != 2 || !strings.Contains(lines[1], "timed out") {
+			t.Errorf("unexpected log of %s:\n%s\n", attempt, out)
+		}
+	}
+}
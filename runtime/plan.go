@@ -2,10 +2,16 @@ package runtime
 
 import (
 	"github.com/troykinsella/crash"
+	"github.com/troykinsella/crash/action"
 	"time"
 	"github.com/troykinsella/crash/system"
+	"github.com/troykinsella/crash/system/scanner"
 	"fmt"
 	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 type TestPlan struct {
@@ -51,6 +57,10 @@ func newPlan(config *crash.PlanConfig) (*Plan, error) {
 		return nil, err
 	}
 
+	if err := checkStepIds(steps, make(map[string]bool)); err != nil {
+		return nil, err
+	}
+
 	return &Plan{
 		Name: config.Name,
 		Steps: steps,
@@ -89,7 +99,34 @@ func parseTimeout(s string) (time.Duration, error) {
 	return d, nil
 }
 
+var stepIdPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// Checks that the step ids are unique within a plan.
+func checkStepIds(steps *Steps, ids map[string]bool) error {
+	if steps == nil {
+		return nil
+	}
+	for _, s := range *steps {
+		if s.Id != "" {
+			if ids[s.Id] {
+				return fmt.Errorf("duplicate step id: %s", s.Id)
+			}
+			ids[s.Id] = true
+		}
+		for _, sub := range []*Steps{s.Serial, s.Parallel, s.Success, s.Failure, s.Always} {
+			if err := checkStepIds(sub, ids); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func newStep(config *crash.StepConfig) (*Step, error) {
+	if config.Id != "" && !stepIdPattern.MatchString(config.Id) {
+		return nil, fmt.Errorf("invalid step id: %s", config.Id)
+	}
+
 	as, err := newActionStep(config.Run)
 	if err != nil {
 		return nil, err
@@ -115,22 +152,80 @@ func newStep(config *crash.StepConfig) (*Step, error) {
 		return nil, err
 	}
 
+	success, err := newSteps(config.Success)
+	if err != nil {
+		return nil, err
+	}
+
+	failure, err := newSteps(config.Failure)
+	if err != nil {
+		return nil, err
+	}
+
+	always, err := newSteps(config.Always)
+	if err != nil {
+		return nil, err
+	}
+
+	merge, err := parseMergePolicy(config.Merge)
+	if err != nil {
+		return nil, err
+	}
+	if config.Merge != "" && ps == nil {
+		return nil, errors.New("merge requires parallel steps")
+	}
+
+	captures, err := newCaptures(config.Capture)
+	if err != nil {
+		return nil, err
+	}
+
+	when, err := system.NewScript(config.When, system.STMT)
+	if err != nil {
+		return nil, err
+	}
+
 	wd, err := newWithDirective(config.With)
 	if err != nil {
 		return nil, err
 	}
 
+	ud, err := newUntilDirective(config.Until)
+	if err != nil {
+		return nil, err
+	}
+	if ud != nil && ch == nil {
+		return nil, errors.New("until requires checks")
+	}
+
+	rd, err := newRetryDirective(config.Retries)
+	if err != nil {
+		return nil, err
+	}
+	if rd != nil && ud != nil {
+		return nil, errors.New("retries can't be combined with until")
+	}
+
 	if as == nil && ss == nil && ps == nil {
 		return nil, errors.New("require action, serial, or parallel step")
 	}
 
 	return &Step{
+		Id: config.Id,
 		Run: as,
 		Serial: ss,
 		Parallel: ps,
+		Merge: merge,
+		Success: success,
+		Failure: failure,
+		Always: always,
+		Captures: captures,
 		Checks: ch,
 		Timeout: to,
+		When: when,
 		With: wd,
+		Until: ud,
+		Retry: rd,
 	}, nil
 }
 
@@ -149,12 +244,229 @@ func newWithDirective(config *crash.WithConfig) (*WithDirective, error) {
 		return nil, err
 	}
 
+	var m map[string]*system.Script
+	if config.Map != nil {
+		m = make(map[string]*system.Script, len(config.Map))
+		for k, v := range config.Map {
+			s, err := system.NewScript(v, system.EXPR)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = s
+		}
+	}
+
+	r, err := newWithRange(config.Range)
+	if err != nil {
+		return nil, err
+	}
+
+	n := 0
+	for _, set := range []bool{it != nil, ls != nil, m != nil, r != nil} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return nil, errors.New("with requires one of item, list, map, or range")
+	}
+	if config.Parallel < 0 {
+		return nil, fmt.Errorf("with parallel must not be negative: %d", config.Parallel)
+	}
+
 	return &WithDirective{
 		Item: it,
 		List: ls,
-		Map: config.Map,
+		Map: m,
+		Range: r,
 
 		As: config.As,
+		Parallel: config.Parallel,
+	}, nil
+}
+
+func newRangeBound(name string, str string) (*RangeBound, error) {
+	if str == "" {
+		return nil, nil
+	}
+	// Expressions can't express negative numbers
+	if n, err := strconv.Atoi(strings.TrimSpace(str)); err == nil {
+		return &RangeBound{
+			Value: n,
+		}, nil
+	}
+
+	s, err := system.NewScript(str, system.EXPR)
+	if err != nil {
+		return nil, fmt.Errorf("with range %s: %s", name, err.Error())
+	}
+	return &RangeBound{
+		Script: s,
+	}, nil
+}
+
+func newWithRange(config *crash.WithRangeConfig) (*WithRange, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.From == "" || config.To == "" {
+		return nil, errors.New("with range requires from and to")
+	}
+
+	from, err := newRangeBound("from", config.From)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := newRangeBound("to", config.To)
+	if err != nil {
+		return nil, err
+	}
+
+	step, err := newRangeBound("step", config.Step)
+	if err != nil {
+		return nil, err
+	}
+	if step == nil {
+		step = &RangeBound{
+			Value: 1,
+		}
+	}
+
+	return &WithRange{
+		From: from,
+		To: to,
+		Step: step,
+	}, nil
+}
+
+// Returns the captures of a step, ordered by name.
+func newCaptures(configs map[string]crash.CaptureConfig) ([]*Capture, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	captures := make([]*Capture, len(names))
+	for i, name := range names {
+		c, err := newCapture(name, configs[name])
+		if err != nil {
+			return nil, fmt.Errorf("capture %s: %s", name, err.Error())
+		}
+		captures[i] = c
+	}
+	return captures, nil
+}
+
+func newCapture(name string, config crash.CaptureConfig) (*Capture, error) {
+	if !scanner.IsIdentifier(name) {
+		return nil, errors.New("invalid variable name")
+	}
+
+	n := 0
+	for _, set := range []bool{config.Expr != "", config.Regex != "", config.Header != ""} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return nil, errors.New("requires one of expr, regex, or header")
+	}
+	if config.Regex == "" && (config.From != "" || config.Group != nil) {
+		return nil, errors.New("from and group require regex")
+	}
+
+	c := &Capture{
+		Name: name,
+		Header: config.Header,
+	}
+
+	if config.Regex != "" {
+		re, err := regexp.Compile(config.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %s", err.Error())
+		}
+		c.Regex = re
+
+		if config.Group != nil {
+			c.Group = *config.Group
+		} else if re.NumSubexp() > 0 {
+			c.Group = 1
+		}
+		if c.Group < 0 || c.Group > re.NumSubexp() {
+			return nil, fmt.Errorf("regex has no group %d", c.Group)
+		}
+
+		from := config.From
+		if from == "" {
+			from = defaultCaptureFrom
+		}
+		config.Expr = from
+	}
+
+	if config.Expr != "" {
+		s, err := system.NewScript(config.Expr, system.EXPR)
+		if err != nil {
+			return nil, err
+		}
+		c.Expr = s
+	}
+
+	return c, nil
+}
+
+func newUntilDirective(config *crash.UntilConfig) (*UntilDirective, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	b, err := newBackoff(config.Backoff, config.Interval, config.MaxInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Attempts < 0 {
+		return nil, fmt.Errorf("until attempts must be greater than zero: %d", config.Attempts)
+	}
+
+	d, err := parsePositiveDuration("until deadline", config.Deadline, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Attempts == 0 && d <= 0 {
+		return nil, errors.New("until requires attempts or a deadline")
+	}
+
+	return &UntilDirective{
+		Backoff: *b,
+		Attempts: config.Attempts,
+		Deadline: d,
+	}, nil
+}
+
+func newRetryDirective(config *crash.RetryConfig) (*RetryDirective, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	if config.Count <= 0 {
+		return nil, fmt.Errorf("retries must be greater than zero: %d", config.Count)
+	}
+
+	b, err := newBackoff(config.Backoff, config.Interval, config.MaxInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RetryDirective{
+		Backoff: *b,
+		Count: config.Count,
 	}, nil
 }
 
@@ -163,7 +475,13 @@ func newActionStep(config *crash.ActionConfig) (*ActionStep, error) {
 		return nil, nil
 	}
 
-	// TODO: some validation
+	if config.Type == "" {
+		return nil, fmt.Errorf("Action has no type: %s", config.Name)
+	}
+	if err := action.Validate(config.Type, config.Params); err != nil {
+		return nil, fmt.Errorf("Invalid action: %s: %s", config.Name, err.Error())
+	}
+
 	return &ActionStep{
 		Name: config.Name,
 		Type: config.Type,
@@ -179,27 +497,103 @@ type Plan struct {
 type Plans []Plan
 
 type Step struct {
+	// Names the outputs of the step, as steps.<id>.<output>
+	Id       string
 	Run      *ActionStep
 	Serial   *Steps
 	Parallel *Steps
 
+	Merge    MergePolicy
+	Success  *Steps
+	Failure  *Steps
+	Always   *Steps
+
+	Captures []*Capture
 	Checks  *system.ScriptList
 	Timeout time.Duration
+	When    *system.Script
 	With    *WithDirective
+	Until   *UntilDirective
+	Retry   *RetryDirective
 }
 
 type Steps []Step
 
+// How the variables set by parallel steps are merged into the enclosing scope.
+type MergePolicy uint8
+
+const (
+	// Variables are merged in the order the steps are listed, such that
+	// the last step to set a variable wins
+	MERGE_ORDERED MergePolicy = iota
+	// The parallel step fails when steps set a variable to different values
+	MERGE_ERROR
+)
+
+func parseMergePolicy(str string) (MergePolicy, error) {
+	switch str {
+	case "", "ordered":
+		return MERGE_ORDERED, nil
+	case "error":
+		return MERGE_ERROR, nil
+	}
+	return 0, fmt.Errorf("invalid merge policy: %s", str)
+}
+
 type ActionStep struct {
 	Name   string
 	Type   string
-	Params map[string]string
+	Params map[string]interface{}
 }
 
 type WithDirective struct {
 	Item    *system.Script
 	List    *system.ScriptList
-	Map     map[string]string
+	Map     map[string]*system.Script
+	Range   *WithRange
 
 	As      string
+
+	// The most iterations run concurrently. Iterations run one after
+	// the other when less than 2.
+	Parallel int
+}
+
+// Iterates integers from From to To, inclusive. Step defaults to 1.
+type WithRange struct {
+	From    *RangeBound
+	To      *RangeBound
+	Step    *RangeBound
+}
+
+// An integer literal, or an expression evaluating to an integer.
+type RangeBound struct {
+	Value   int
+	Script  *system.Script
+}
+
+// Re-runs a failed step, waiting between attempts, up to Count times.
+type RetryDirective struct {
+	Backoff
+	Count int
+}
+
+// The output that a regex capture matches by default.
+const defaultCaptureFrom = "body"
+
+// Sets a variable to a value extracted from the outputs of a step: the
+// result of an expression, a regex match of one, or a response header.
+type Capture struct {
+	Name    string
+	Expr    *system.Script
+	Regex   *regexp.Regexp
+	Group   int
+	Header  string
+}
+
+// Repeats a step, waiting between attempts, until its checks pass.
+type UntilDirective struct {
+	Backoff
+	Attempts int
+	Deadline time.Duration
 }
@@ -0,0 +1,221 @@
+package runtime
+
+import (
+	"testing"
+	"github.com/troykinsella/crash"
+)
+
+func TestNewWithDirective(t *testing.T) {
+	var tests = []struct {
+		config *crash.WithConfig
+		err    string
+	}{
+		{&crash.WithConfig{List: []string{"1", "2"}}, ""},
+		{&crash.WithConfig{Map: map[string]string{"a": "1"}}, ""},
+		{&crash.WithConfig{Range: &crash.WithRangeConfig{From: "1", To: "n"}}, ""},
+		{&crash.WithConfig{Range: &crash.WithRangeConfig{From: "3", To: "1", Step: "-1"}}, ""},
+		{&crash.WithConfig{Range: &crash.WithRangeConfig{From: "1"}}, "with range requires from and to"},
+		{&crash.WithConfig{}, "with requires one of item, list, map, or range"},
+		{&crash.WithConfig{Item: "n", List: []string{"1"}}, "with requires one of item, list, map, or range"},
+		{&crash.WithConfig{Item: "n", Parallel: 50}, ""},
+		{&crash.WithConfig{Item: "n", Parallel: -1}, "with parallel must not be negative: -1"},
+	}
+
+	for i, test := range tests {
+		_, err := newWithDirective(test.config)
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		}
+		if actual != test.err {
+			t.Errorf("%d. unexpected error:\nexpected=%q,\nactual=%q\n", i, test.err, actual)
+		}
+	}
+
+	w, err := newWithDirective(&crash.WithConfig{Range: &crash.WithRangeConfig{From: "3", To: "1", Step: "-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Range.From.Value != 3 || w.Range.To.Value != 1 || w.Range.Step.Value != -1 {
+		t.Errorf("unexpected range bounds: %v, %v, %v\n", w.Range.From, w.Range.To, w.Range.Step)
+	}
+}
+
+func TestNewStepWhen(t *testing.T) {
+	var tests = []struct {
+		when string
+		set  bool
+		err  bool
+	}{
+		{"", false, false},
+		{"env eq 'prod'", true, false},
+		{"env eq 'prod", false, true},
+	}
+
+	for i, test := range tests {
+		s, err := newStep(&crash.StepConfig{
+			Run: &crash.ActionConfig{
+				Name: "a",
+				Type: "shell",
+				Params: map[string]interface{}{
+					"command": "true",
+				},
+			},
+			When: test.when,
+		})
+		if (err != nil) != test.err {
+			t.Errorf("%d. unexpected error: %v\n", i, err)
+			continue
+		}
+		if err == nil && (s.When != nil) != test.set {
+			t.Errorf("%d. unexpected when: %v\n", i, s.When)
+		}
+	}
+}
+
+func TestStepIds(t *testing.T) {
+	var tests = []struct {
+		yaml string
+		err  string
+	}{
+		{"[{id: a, serial: [{id: b, run: {name: b, type: shell, params: {command: 'true'}}}]}]", ""},
+		{"[{id: 1a, run: {name: a, type: shell, params: {command: 'true'}}}]", "invalid step id: 1a"},
+		{"[{id: a.b, run: {name: a, type: shell, params: {command: 'true'}}}]", "invalid step id: a.b"},
+		{"[{id: a, serial: [{id: a, run: {name: b, type: shell, params: {command: 'true'}}}]}]", "duplicate step id: a"},
+		{"[{id: a, run: {name: a, type: shell, params: {command: 'true'}}, always: [{id: a, run: {name: b, type: shell, params: {command: 'true'}}}]}]", "duplicate step id: a"},
+	}
+
+	for i, test := range tests {
+		config := crash.NewConfig()
+		if err := config.UnmarshalYAML([]byte("plans: [{plan: p, steps: " + test.yaml + "}]")); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := CompileTestPlan(config)
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		}
+		if actual != test.err {
+			t.Errorf("%d. unexpected error:\nexpected=%q,\nactual=%q\n", i, test.err, actual)
+		}
+	}
+}
+
+func TestNewCaptures(t *testing.T) {
+	var tests = []struct {
+		yaml  string
+		group int
+		err   string
+	}{
+		{"json.token", 0, ""},
+		{"{expr: json.token}", 0, ""},
+		{"{header: Location}", 0, ""},
+		{"{regex: 'id=\\d+'}", 0, ""},
+		{"{regex: 'id=(\\d+)', from: out}", 1, ""},
+		{"{regex: '(a)(b)', group: 2}", 2, ""},
+		{"{regex: '(a)', group: 2}", 0, "capture v: regex has no group 2"},
+		{"{regex: '('}", 0, "capture v: invalid regex: error parsing regexp: missing closing ): `(`"},
+		{"{header: Location, from: body}", 0, "capture v: from and group require regex"},
+		{"{expr: a, header: Location}", 0, "capture v: requires one of expr, regex, or header"},
+		{"{}", 0, "capture v: requires one of expr, regex, or header"},
+	}
+
+	for i, test := range tests {
+		config := crash.NewConfig()
+		yaml := "plans: [{plan: p, steps: [{run: {name: a, type: shell, params: {command: 'true'}}, capture: {v: " + test.yaml + "}}]}]"
+		if err := config.UnmarshalYAML([]byte(yaml)); err != nil {
+			t.Fatal(err)
+		}
+
+		tp, err := CompileTestPlan(config)
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		}
+		if actual != test.err {
+			t.Errorf("%d. unexpected error:\nexpected=%q,\nactual=%q\n", i, test.err, actual)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		c := (*(*tp.Plans)[0].Steps)[0].Captures[0]
+		if c.Name != "v" || c.Group != test.group {
+			t.Errorf("%d. unexpected capture: %+v\n", i, c)
+		}
+	}
+}
+
+func TestCaptureNames(t *testing.T) {
+	var tests = []struct {
+		name string
+		err  string
+	}{
+		{"token", ""},
+		{"token2", ""},
+		{"user_id", ""},
+		{"2fa", "capture 2fa: invalid variable name"},
+		{"'a.b'", "capture a.b: invalid variable name"},
+		{"'and'", "capture and: invalid variable name"},
+	}
+
+	for i, test := range tests {
+		config := crash.NewConfig()
+		yaml := "plans: [{plan: p, steps: [{run: {name: a, type: shell, params: {command: 'true'}}, capture: {" + test.name + ": out}}]}]"
+		if err := config.UnmarshalYAML([]byte(yaml)); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := CompileTestPlan(config)
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		}
+		if actual != test.err {
+			t.Errorf("%d. unexpected error:\nexpected=%q,\nactual=%q\n", i, test.err, actual)
+		}
+	}
+}
+
+func TestNewRetryDirective(t *testing.T) {
+	var tests = []struct {
+		yaml  string
+		count int
+		err   string
+	}{
+		{"retries: 3", 3, ""},
+		{"retries: {count: 2, interval: 10ms, backoff: jitter}", 2, ""},
+		{"retries: 0", 0, "retries must be greater than zero: 0"},
+		{"retries: {interval: 1s}", 0, "retries must be greater than zero: 0"},
+		{"retries: {count: 1, backoff: linear}", 0, "invalid backoff; expected fixed, exponential, or jitter: linear"},
+		{"retries: 1, until: {attempts: 2}, check: [\"out eq 'x'\"]", 0, "retries can't be combined with until"},
+	}
+
+	for i, test := range tests {
+		config := crash.NewConfig()
+		yaml := "plans: [{plan: p, steps: [{run: {name: a, type: shell, params: {command: 'true'}}, " + test.yaml + "}]}]"
+		if err := config.UnmarshalYAML([]byte(yaml)); err != nil {
+			t.Fatal(err)
+		}
+
+		tp, err := CompileTestPlan(config)
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		}
+		if actual != test.err {
+			t.Errorf("%d. unexpected error:\nexpected=%q,\nactual=%q\n", i, test.err, actual)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		r := (*(*tp.Plans)[0].Steps)[0].Retry
+		if r.Count != test.count {
+			t.Errorf("%d. unexpected retry count:\nexpected=%d,\nactual=%d\n", i, test.count, r.Count)
+		}
+	}
+}
@@ -9,12 +9,28 @@ type StepExec struct {
 	stopWatch *util.StopWatch
 	Step *Step
 	looped bool
+	polled bool
+	retried bool
+
+	// Which attempt of a retried step this is
+	attempt int
 }
 
 type StepResult struct {
-	Ok    bool
-	Data  map[string]interface{}
-	Error error
+	Ok     bool
+	Data   map[string]interface{}
+	Error  error
+
+	// Why the step failed
+	Reason string
+
+	// Whether the step didn't run because its when expression was false
+	Skipped bool
+
+	// The number of times a retried step ran, and whether it failed
+	// before passing
+	Attempts int
+	Flaky    bool
 }
 
 func NewStepExec(step *Step) *StepExec {
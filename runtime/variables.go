@@ -1,6 +1,7 @@
 package runtime
 
 import (
+	"sync"
 	"github.com/troykinsella/crash/util"
 )
 
@@ -13,9 +14,16 @@ type Variables interface {
 	AsMap() map[string]interface{}
 	NewChild() Variables
 	Commit() Variables
+
+	// Returns a copy of the variables set in this scope, excluding
+	// those inherited from its parents.
+	Locals() map[string]interface{}
 }
 
+// A scope of variables, which inherits those of its parent scope. Scopes
+// may be read and written concurrently.
 type varNode struct {
+	mutex  sync.RWMutex
 	parent *varNode
 	vars   map[string]interface{}
 }
@@ -31,7 +39,10 @@ func (v *varNode) Names() []string {
 }
 
 func (v *varNode) Get(name string) interface{} {
+	v.mutex.RLock()
 	result := v.vars[name]
+	v.mutex.RUnlock()
+
 	if result == nil && v.parent != nil {
 		result = v.parent.Get(name)
 	}
@@ -43,10 +54,14 @@ func (v *varNode) GetString(name string) string {
 }
 
 func (v *varNode) Set(name string, value interface{}) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
 	v.vars[name] = value
 }
 
 func (v *varNode) SetAll(values map[string]interface{}) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
 	for key, val := range values {
 		v.vars[key] = val
 	}
@@ -56,11 +71,9 @@ func (v *varNode) AsMap() (map[string]interface{}) {
 	vars := make(map[string]interface{})
 
 	stackSize := 0
-	varCount := 0
 	n := v
 	for n != nil {
 		stackSize++
-		varCount += len(n.vars)
 		n = n.parent
 	}
 
@@ -76,7 +89,9 @@ func (v *varNode) AsMap() (map[string]interface{}) {
 
 	i = 0
 	for i < stackSize {
+		stack[i].mutex.RLock()
 		util.PutAllForMapStringInterface(vars, stack[i].vars)
+		stack[i].mutex.RUnlock()
 		i++
 	}
 
@@ -91,7 +106,16 @@ func (v *varNode) NewChild() Variables {
 }
 
 func (v *varNode) Commit() Variables {
-	v.parent.SetAll(v.vars)
+	v.parent.SetAll(v.Locals())
 
 	return v.parent
 }
+
+func (v *varNode) Locals() map[string]interface{} {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	result := make(map[string]interface{}, len(v.vars))
+	util.PutAllForMapStringInterface(result, v.vars)
+	return result
+}
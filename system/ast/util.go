@@ -1,19 +1,48 @@
 package ast
 
 import (
-	"go/types"
 	"reflect"
 	"net/http"
+	"fmt"
+	"github.com/troykinsella/crash/system/data"
 )
 
 func extractValue(operand interface{}, key interface{}) (interface{}, error) {
 	switch o := operand.(type) {
 	case http.Header:
-		return o.Get(key.(string)), nil
-	case types.Map:
-		v := reflect.ValueOf(operand)
+		k, err := data.ToString(key)
+		if err != nil {
+			return nil, err
+		}
+		return o.Get(k), nil
+	case map[string]interface{}:
+		k, err := data.ToString(key)
+		if err != nil {
+			return nil, err
+		}
+		return o[k], nil
+	case []interface{}:
+		i, err := data.ToInt(key)
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= int64(len(o)) {
+			return nil, fmt.Errorf("Index out of range: %d", i)
+		}
+		return o[i], nil
+	}
+
+	v := reflect.ValueOf(operand)
+	if v.Kind() == reflect.Map && key != nil {
 		kv := reflect.ValueOf(key)
-		return v.MapIndex(kv), nil
+		if !kv.Type().AssignableTo(v.Type().Key()) {
+			return nil, nil
+		}
+		mv := v.MapIndex(kv)
+		if !mv.IsValid() {
+			return nil, nil
+		}
+		return mv.Interface(), nil
 	}
 
 	return nil, nil
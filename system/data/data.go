@@ -67,6 +67,16 @@ func ToInt(any interface{}) (int64, error) {
 		return int64(any.(int32)), nil
 	case int64:
 		return any.(int64), nil
+	case uint:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
 	case string:
 		return strconv.ParseInt(v, 10, 0)
 	}
@@ -90,7 +100,7 @@ func LooseEqual(left, right interface{}) (bool, error) {
 		}
 		return l == r, nil
 	case int, int8, int16, int32, int64:
-		li := int64(l.(int))
+		li, _ := ToInt(l)
 		r, err := ToInt(right)
 		if err != nil {
 			return false, nil // Allow parse errors
@@ -140,7 +150,10 @@ func Compare(left, right interface{}) (int, error) {
 		}
 		return CompareBool(l, r), nil
 	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
-		li := int64(l.(int))
+		li, err := ToInt(l)
+		if err != nil {
+			return 0, err
+		}
 		r, err := ToInt(right)
 		if err != nil {
 			return 0, nil // Allow parse errors
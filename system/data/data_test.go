@@ -29,6 +29,11 @@ func TestLooseEqual(t *testing.T) {
 		{"foo", "",    false},
 		{"",    "foo", false},
 
+		// integers
+		{int64(1), 1,        true},
+		{int64(1), int64(2), false},
+		{int32(1), "1",      true},
+
 		// bools
 		{true,    true,    true},
 		{true,    false,   false},
@@ -111,6 +116,10 @@ func TestCompare(t *testing.T) {
 		{0,   0,   0},
 		{1,   0,   1},
 		{0,   1,   -1},
+		{int64(2), 1,        1},
+		{int64(1), int64(2), -1},
+		{int8(1),  "1",      0},
+		{uint(3),  int64(3), 0},
 
 		// bools
 		{true,  true,  0},
@@ -134,7 +143,7 @@ func TestCompare(t *testing.T) {
 		if err != nil {
 			t.Errorf("error: %s", err.Error())
 		} else if cmp != test.cmp {
-			t.Errorf("%v. unexpected compare result: expected=%t actual=%t", test, test.cmp, cmp)
+			t.Errorf("%v. unexpected compare result: expected=%d actual=%d", test, test.cmp, cmp)
 		}
 	}
 }
@@ -16,6 +16,10 @@ func Interpolate(str string, vars util.Values) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if istr == nil {
+		// Empty string
+		return "", nil
+	}
 
 	ctx := exec.NewContext(vars, nil)
 	_, result, err := istr.Exec(ctx)
@@ -26,36 +30,49 @@ func Interpolate(str string, vars util.Values) (string, error) {
 	return result, nil
 }
 
-type interpVals struct {
-	wrapped util.Values
-	vars util.Values
-}
-
-func (i *interpVals) Get(name string) interface{} {
-	return i.GetString(name)
-}
-
-func (i *interpVals) GetString(name string) string {
-	val := i.wrapped.GetString(name)
-	str, err := Interpolate(val, i.vars)
-	if err != nil {
-		panic(err)
+func interpolateValue(val interface{}, vars util.Values) (interface{}, error) {
+	switch v := val.(type) {
+	case string:
+		return Interpolate(v, vars)
+	case map[string]interface{}, map[interface{}]interface{}:
+		m := util.ToStringMap(v)
+		result := make(map[string]interface{}, len(m))
+		for k, mv := range m {
+			iv, err := interpolateValue(mv, vars)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = iv
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, lv := range v {
+			iv, err := interpolateValue(lv, vars)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = iv
+		}
+		return result, nil
 	}
-	return str
-}
-
-func (i *interpVals) AsMap() map[string]interface{} {
-	// TODO: interp each value
-	return i.wrapped.AsMap()
+	return val, nil
 }
 
-func NewInterpolatedValues(wrapped util.Values, vars util.Values) util.Values {
+// Interpolates the variables into each of the values, recursing into maps
+// and lists, failing when a value can't be interpolated.
+func InterpolateValues(vals util.Values, vars util.Values) (util.Values, error) {
 	if vars == nil {
-		vars = wrapped
+		vars = vals
 	}
 
-	return &interpVals{
-		wrapped: wrapped,
-		vars: vars,
+	result := make(map[string]interface{})
+	for k, v := range vals.AsMap() {
+		iv, err := interpolateValue(v, vars)
+		if err != nil {
+			return nil, err
+		}
+		result[k] = iv
 	}
+	return util.AsValues(result), nil
 }
@@ -1,6 +1,7 @@
 package system
 
 import (
+	"reflect"
 	"testing"
 	"github.com/troykinsella/crash/util"
 )
@@ -9,6 +10,11 @@ func TestInterpolate(t *testing.T) {
 	vars := util.AsValues(map[string]interface{}{
 		"foo": "few",
 		"bar": "bahr",
+		"json": map[string]interface{}{
+			"data": []interface{}{
+				map[string]interface{}{ "id": 42 },
+			},
+		},
 	})
 
 	var tests = []struct {
@@ -16,6 +22,7 @@ func TestInterpolate(t *testing.T) {
 		out string
 		err string
 	}{
+		{ "", "", "" },
 		{ "foo", "foo", "" },
 		{ "$foo", "few", "" },
 		{ "${foo}", "few", "" },
@@ -29,6 +36,8 @@ func TestInterpolate(t *testing.T) {
 		{ "a${foo}${bar}b", "afewbahrb", "" },
 		{ "a${foo}b${bar}c", "afewbbahrc", "" },
 		{ "a$foo.stuff", "afew.stuff", "" },
+		{ "${json.data[0].id}", "42", "" },
+		{ "${json.data[1].id}", "", "Index out of range: 1" },
 
 		{ "$foobar", "", "Not found: foobar" },
 		{ "${foobar}", "", "Not found: foobar" },
@@ -54,3 +63,41 @@ func TestInterpolate(t *testing.T) {
 		}
 	}
 }
+
+func TestInterpolateValues(t *testing.T) {
+	vars := util.AsValues(map[string]interface{}{
+		"foo": "few",
+	})
+
+	vals, err := InterpolateValues(util.AsValues(map[string]interface{}{
+		"str":  "a$foo",
+		"none": "",
+		"num":  1.5,
+		"list": []interface{}{"$foo", 2},
+		"map":  map[interface{}]interface{}{"k": "${foo}"},
+	}), vars)
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err.Error())
+	}
+
+	expected := map[string]interface{}{
+		"str":  "afew",
+		"none": "",
+		"num":  1.5,
+		"list": []interface{}{"few", 2},
+		"map":  map[string]interface{}{"k": "few"},
+	}
+	if !reflect.DeepEqual(vals.AsMap(), expected) {
+		t.Errorf("unexpected values:\nexpected=%v,\nactual=%v\n", expected, vals.AsMap())
+	}
+	if s := vals.GetString("num"); s != "1.5" {
+		t.Errorf("unexpected string: %q\n", s)
+	}
+
+	_, err = InterpolateValues(util.AsValues(map[string]interface{}{
+		"list": []interface{}{"$foobar"},
+	}), vars)
+	if err == nil || err.Error() != "Not found: foobar" {
+		t.Errorf("unexpected error:\nexpected=Not found: foobar,\nactual=%v\n", err)
+	}
+}
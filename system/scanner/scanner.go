@@ -11,6 +11,15 @@ import (
 
 var eof = rune(0)
 
+var keywords = map[string]token.Token{
+	"true":  token.TRUE,
+	"false": token.FALSE,
+	"and":   token.AND,
+	"not":   token.NOT,
+	"or":    token.OR,
+	"xor":   token.XOR,
+}
+
 
 type Scanner struct {
 	in *RuneReader
@@ -115,7 +124,8 @@ func (s *Scanner) consumeIdentifier() (token.Token, string) {
 		if ch == eof {
 			break
 		}
-		if isIdentifier(ch) {
+		// Digits may follow the first character
+		if isIdentifier(ch) || isDigit(ch) {
 			buf.WriteRune(ch)
 		} else {
 			s.unread()
@@ -124,20 +134,8 @@ func (s *Scanner) consumeIdentifier() (token.Token, string) {
 	}
 
 	str := buf.String()
-
-	switch str {
-	case "true":
-		return token.TRUE, ""
-	case "false":
-		return token.FALSE, ""
-	case "and":
-		return token.AND, ""
-	case "not":
-		return token.NOT, ""
-	case "or":
-		return token.OR, ""
-	case "xor":
-		return token.XOR, ""
+	if tok, ok := keywords[str]; ok {
+		return tok, ""
 	}
 
 	return token.IDENT, str
@@ -276,6 +274,21 @@ func isIdentifier(ch rune) bool {
 	return isLetter(ch) || ch == '_' || ch == '-'
 }
 
+// Returns whether the string scans as a single identifier, such that
+// it can name a variable.
+func IsIdentifier(str string) bool {
+	if str == "" {
+		return false
+	}
+	for i, ch := range str {
+		if !isIdentifier(ch) && (i == 0 || !isDigit(ch)) {
+			return false
+		}
+	}
+	_, keyword := keywords[str]
+	return !keyword
+}
+
 func isString(ch rune) bool {
 	return ch == '"' || ch == '\'' || ch == '`'
 }
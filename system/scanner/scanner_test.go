@@ -38,6 +38,8 @@ func TestScanner_Scan(t *testing.T) {
 		{"\r",     token.WS,                   "\r" },
 		{"\n",     token.WS,                   "\n" },
 		{"foo",    token.IDENT,                "foo"},
+		{"foo1",   token.IDENT,                "foo1"},
+		{"a1-b_2", token.IDENT,                "a1-b_2"},
 		{"1",      token.NUMBER,               "1"},
 		{"123",    token.NUMBER,               "123"},
 		{"'foo'",  token.STRING,               "foo"},
@@ -259,3 +261,26 @@ func TestScanner_usage(t *testing.T) {
 	tokEq(tok, token.EOF, t)
 	strEq(lit, "", t)
 }
+
+func TestIsIdentifier(t *testing.T) {
+	var tests = []struct {
+		str string
+		ok  bool
+	}{
+		{"foo",    true},
+		{"token2", true},
+		{"_a-b",   true},
+		{"",       false},
+		{"2fa",    false},
+		{"a.b",    false},
+		{"a b",    false},
+		{"and",    false},
+		{"true",   false},
+	}
+
+	for i, test := range tests {
+		if ok := IsIdentifier(test.str); ok != test.ok {
+			t.Errorf("%d. %q: unexpected result: expected=%t actual=%t", i, test.str, test.ok, ok)
+		}
+	}
+}
@@ -1,10 +1,21 @@
 package util
 
-import "errors"
+import (
+	"errors"
+)
 
 type Iterator interface {
 	HasNext() bool
 	Next() interface{}
+
+	// The total number of elements iterated
+	Len() int
+}
+
+// A key and its value, yielded by a map iterator.
+type Entry struct {
+	Key   string
+	Value interface{}
 }
 
 type rangeIterator struct {
@@ -49,6 +60,10 @@ func (ri *rangeIterator) Next() interface{} {
 	return i
 }
 
+func (ri *rangeIterator) Len() int {
+	return (ri.to - ri.from) / ri.step + 1
+}
+
 type sliceIterator struct {
 	i int
 	l int
@@ -75,3 +90,40 @@ func (si *sliceIterator) Next() interface{} {
 	si.i += 1
 	return si.s[i]
 }
+
+func (si *sliceIterator) Len() int {
+	return si.l
+}
+
+type mapIterator struct {
+	i    int
+	keys []string
+	m    map[string]interface{}
+}
+
+// Iterates the entries of the map, ordered by key.
+func NewMapIterator(m map[string]interface{}) (Iterator, error) {
+	if m == nil {
+		return nil, errors.New("nil map")
+	}
+	keys := SortedKeysForMapStringInterface(m)
+	return &mapIterator{0, keys, m}, nil
+}
+
+func (mi *mapIterator) HasNext() bool {
+	return mi.i < len(mi.keys)
+}
+
+func (mi *mapIterator) Next() interface{} {
+	if !mi.HasNext() {
+		return nil
+	}
+
+	k := mi.keys[mi.i]
+	mi.i += 1
+	return Entry{k, mi.m[k]}
+}
+
+func (mi *mapIterator) Len() int {
+	return len(mi.keys)
+}
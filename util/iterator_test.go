@@ -0,0 +1,71 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func collect(itr Iterator) []interface{} {
+	result := make([]interface{}, 0)
+	for itr.HasNext() {
+		result = append(result, itr.Next())
+	}
+	return result
+}
+
+func TestRangeIterator(t *testing.T) {
+	var tests = []struct {
+		from     int
+		to       int
+		step     int
+		expected []interface{}
+	}{
+		{0, 3, 1, []interface{}{0, 1, 2, 3}},
+		{1, 6, 2, []interface{}{1, 3, 5}},
+		{3, 1, -1, []interface{}{3, 2, 1}},
+		{5, 5, 1, []interface{}{5}},
+	}
+
+	for i, test := range tests {
+		itr, err := NewRangeIterator(test.from, test.to, test.step)
+		if err != nil {
+			t.Errorf("%d. unexpected error: %s\n", i, err.Error())
+			continue
+		}
+		if itr.Len() != len(test.expected) {
+			t.Errorf("%d. unexpected length:\nexpected=%d,\nactual=%d\n", i, len(test.expected), itr.Len())
+		}
+		actual := collect(itr)
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%d. unexpected values:\nexpected=%v,\nactual=%v\n", i, test.expected, actual)
+		}
+	}
+
+	if _, err := NewRangeIterator(3, 1, 1); err == nil {
+		t.Errorf("expected error for from > to\n")
+	}
+}
+
+func TestMapIterator(t *testing.T) {
+	itr, err := NewMapIterator(map[string]interface{}{
+		"b": 2,
+		"c": 3,
+		"a": 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []interface{}{
+		Entry{"a", 1},
+		Entry{"b", 2},
+		Entry{"c", 3},
+	}
+	if itr.Len() != len(expected) {
+		t.Errorf("unexpected length:\nexpected=%d,\nactual=%d\n", len(expected), itr.Len())
+	}
+	actual := collect(itr)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected entries:\nexpected=%v,\nactual=%v\n", expected, actual)
+	}
+}
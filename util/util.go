@@ -1,6 +1,9 @@
 package util
 
-import "time"
+import (
+	"sort"
+	"time"
+)
 
 func KeysForMapStringInterface(obj map[string]interface{}) []string {
 	result := make([]string, len(obj))
@@ -12,6 +15,12 @@ func KeysForMapStringInterface(obj map[string]interface{}) []string {
 	return result
 }
 
+func SortedKeysForMapStringInterface(obj map[string]interface{}) []string {
+	result := KeysForMapStringInterface(obj)
+	sort.Strings(result)
+	return result
+}
+
 func PutAllForMapStringInterface(dest map[string]interface{}, source map[string]interface{}) {
 	for k, v := range source {
 		dest[k] = v
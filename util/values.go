@@ -2,6 +2,7 @@ package util
 
 import (
 	"fmt"
+	"strconv"
 )
 
 type Values interface {
@@ -36,6 +37,12 @@ func ToString(val interface{}) string {
 		return val.(string)
 	case int, int8, int16, int32, int64:
 		return fmt.Sprintf("%d", val)
+	case uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", val)
+	case float32:
+		return strconv.FormatFloat(float64(val.(float32)), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(val.(float64), 'f', -1, 64)
 	case bool:
 		return fmt.Sprintf("%t", val)
 	}
@@ -57,3 +64,17 @@ func AsStringValues(vals map[string]string) Values {
 		vals: strs,
 	}
 }
+
+func ToStringMap(val interface{}) map[string]interface{} {
+	switch m := val.(type) {
+	case map[string]interface{}:
+		return m
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			result[ToString(k)] = v
+		}
+		return result
+	}
+	return nil
+}
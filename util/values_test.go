@@ -0,0 +1,31 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestToString(t *testing.T) {
+	var tests = []struct {
+		val      interface{}
+		expected string
+	}{
+		{nil, ""},
+		{"foo", "foo"},
+		{42, "42"},
+		{int64(-7), "-7"},
+		{uint8(3), "3"},
+		{1.5, "1.5"},
+		{2.0, "2"},
+		{0.1, "0.1"},
+		{float32(0.25), "0.25"},
+		{1e21, "1000000000000000000000"},
+		{true, "true"},
+		{[]interface{}{1}, ""},
+	}
+
+	for i, test := range tests {
+		if s := ToString(test.val); s != test.expected {
+			t.Errorf("%d. unexpected string:\nexpected=%q,\nactual=%q\n", i, test.expected, s)
+		}
+	}
+}